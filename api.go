@@ -1,25 +1,37 @@
 package acrouter
 
 import (
+	"context"
+	"net"
+	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
 type ApiServer struct {
-	Engine   *gin.Engine
-	ipAddr   string
-	port     int
-	certFile string
-	keyFile  string
+	Engine *gin.Engine
+	Server *http.Server
+	// Time in-flight requests get to finish on shutdown
+	ShutdownTimeout time.Duration
+	ipAddr          string
+	port            int
+	certFile        string
+	keyFile         string
 }
 
 func NewApiServer(ipAddr string, port int) *ApiServer {
 	gin.SetMode(gin.ReleaseMode)
 	s := &ApiServer{
-		ipAddr: ipAddr,
-		port:   port,
-		Engine: gin.New(),
+		ipAddr:          ipAddr,
+		port:            port,
+		Engine:          gin.New(),
+		ShutdownTimeout: 10 * time.Second,
+	}
+	s.Server = &http.Server{
+		Addr:    ipAddr + ":" + strconv.Itoa(port),
+		Handler: s.Engine,
 	}
 	s.setMiddleware()
 	return s
@@ -69,10 +81,39 @@ func (aps *ApiServer) SetNoRoute(handlerFunc gin.HandlerFunc) {
 
 // Run api server
 func (aps *ApiServer) Run() error {
-	return aps.Engine.Run(aps.ipAddr + ":" + strconv.Itoa(aps.port))
+	return aps.Server.ListenAndServe()
 }
 
 // Run api tls server
 func (aps *ApiServer) RunTLS() error {
-	return aps.Engine.RunTLS(aps.ipAddr+":"+strconv.Itoa(aps.port), aps.certFile, aps.keyFile)
+	return aps.Server.ListenAndServeTLS(aps.certFile, aps.keyFile)
+}
+
+// Run api server until ctx is done, then shut down gracefully
+func (aps *ApiServer) RunContext(ctx context.Context) error {
+	return aps.serveContext(ctx, aps.Run)
+}
+
+// Run api tls server until ctx is done, then shut down gracefully
+func (aps *ApiServer) RunTLSContext(ctx context.Context) error {
+	return aps.serveContext(ctx, aps.RunTLS)
+}
+
+// Request contexts derive from ctx, so handlers observe the shutdown
+func (aps *ApiServer) serveContext(ctx context.Context, serve func() error) error {
+	aps.Server.BaseContext = func(net.Listener) context.Context {
+		return ctx
+	}
+	errc := make(chan error, 1)
+	go func() {
+		errc <- serve()
+	}()
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), aps.ShutdownTimeout)
+		defer cancel()
+		return aps.Server.Shutdown(shutdownCtx)
+	}
 }
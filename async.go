@@ -0,0 +1,340 @@
+package acrouter
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+	"github.com/urfave/cli/v2"
+	"github.com/zfs123/go-ac-router/auth"
+	"github.com/zfs123/go-ac-router/handle"
+	"github.com/zfs123/go-ac-router/jobs"
+	"github.com/zfs123/go-ac-router/utils"
+)
+
+// DefaultJobsPath is the path the job routes are registered under
+const DefaultJobsPath = "/jobs"
+
+// DefaultJobTTL is how long finished jobs are kept
+const DefaultJobTTL = 24 * time.Hour
+
+// JobTokenHeader carries the token of a job started anonymously
+const JobTokenHeader = "X-Job-Token"
+
+// Interval the cli polls the job store when following a job
+const jobPollInterval = 200 * time.Millisecond
+
+// Run the route handler as a background job
+//
+// The api answers 202 with the job id, the cli command gets --async and --wait flags
+func Async() RouteOption {
+	return func(route *Route) {
+		route.Async = true
+	}
+}
+
+// Get the job manager, its store holds the jobs of async routes
+func (r *Router) Jobs() *jobs.Manager {
+	return r.jobs
+}
+
+// Start the handler as a job and answer 202 with its status url
+func (r *Router) asyncApiHandler(route *Route) gin.HandlerFunc {
+	name := route.Method + " " + route.Path
+	r.asyncRoutes[name] = route
+	return func(c *gin.Context) {
+		// the job outlives the request, so keep the body in memory
+		body, err := ioutil.ReadAll(c.Request.Body)
+		if err != nil {
+			abortWithError(c, http.StatusBadRequest, "read request body failed")
+			return
+		}
+		c.Request.Body = ioutil.NopCloser(bytes.NewReader(body))
+		cp := c.Copy()
+		// kept to authorize reads of the result like the request itself
+		params := c.Request.URL.Query()
+		for _, p := range c.Params {
+			params.Set(p.Key, p.Value)
+		}
+
+		job, err := r.jobs.Start(c.Request.Context(), name, handle.RequestIDFromContext(c.Request.Context()), params,
+			func(ctx context.Context, response *jobs.Response) {
+				cp.Request = cp.Request.WithContext(ctx)
+				route.HandleFunc(handle.NewApiAction(cp), response)
+			})
+		if err != nil {
+			abortWithError(c, http.StatusInternalServerError, "start job failed")
+			return
+		}
+		statusURL := r.config.JobsPath + "/" + job.ID
+		c.Header("Location", statusURL)
+		accepted := gin.H{"job_id": job.ID, "status": job.Status, "status_url": statusURL}
+		if job.Token != "" {
+			// the only proof of ownership of anonymous jobs, it is required by the job routes
+			accepted["job_token"] = job.Token
+		}
+		c.JSON(http.StatusAccepted, accepted)
+	}
+}
+
+// Register the job routes once the first async route is added
+//
+// Every job is authenticated like the route that started it, anonymous jobs
+// need their token in the X-Job-Token header instead
+func (r *Router) addJobRoutes() {
+	if r.jobRoutes {
+		return
+	}
+	r.jobRoutes = true
+
+	path := r.config.JobsPath
+	r.api.Engine.GET(path, func(c *gin.Context) {
+		list, err := r.jobs.Store().List()
+		if err != nil {
+			abortWithError(c, http.StatusInternalServerError, err.Error())
+			return
+		}
+		// the caller is authenticated once per route, anonymous jobs are not listed
+		principals := map[string]*auth.Principal{}
+		owned := make([]*jobs.Job, 0, len(list))
+		for _, job := range list {
+			p, ok := principals[job.Route]
+			if !ok {
+				p, _ = auth.Authenticate(c.Request, r.jobAuthenticators(job)...)
+				principals[job.Route] = p
+			}
+			if job.OwnedBy(p) {
+				owned = append(owned, job)
+			}
+		}
+		c.JSON(http.StatusOK, owned)
+	})
+	r.api.Engine.GET(path+"/:id", func(c *gin.Context) {
+		if job := r.findJob(c); job != nil {
+			c.JSON(http.StatusOK, job)
+		}
+	})
+	r.api.Engine.GET(path+"/:id/result", func(c *gin.Context) {
+		job := r.findJob(c)
+		switch {
+		case job == nil:
+		case !r.authorizeJob(c, job):
+		case !job.Status.Finished():
+			c.Header("Location", path+"/"+job.ID)
+			c.JSON(http.StatusAccepted, gin.H{"job_id": job.ID, "status": job.Status})
+		case job.Status == jobs.StatusCancelled:
+			abortWithError(c, http.StatusConflict, "job was cancelled")
+		case job.Code == 0:
+			c.Status(http.StatusNoContent)
+		default:
+			resp := handle.NewApiResponse(c)
+			if job.Meta != nil {
+				resp.SetMeta(*job.Meta)
+			}
+			resp.Response(job.Code, job.Result)
+		}
+	})
+	r.api.Engine.DELETE(path+"/:id", func(c *gin.Context) {
+		job := r.findJob(c)
+		if job == nil {
+			return
+		}
+		if err := r.jobs.Cancel(job.ID); err != nil {
+			abortWithError(c, http.StatusConflict, err.Error())
+			return
+		}
+		c.JSON(http.StatusAccepted, gin.H{"job_id": job.ID, "status": "cancelling"})
+	})
+}
+
+// Load the job of the id parameter and authenticate its owner, answers 404
+// if it does not exist or belongs to someone else
+func (r *Router) findJob(c *gin.Context) *jobs.Job {
+	job, err := r.jobs.Store().Get(c.Param("id"))
+	if err != nil && errors.Cause(err) != jobs.ErrNotFound {
+		abortWithError(c, http.StatusInternalServerError, err.Error())
+		return nil
+	}
+	if job != nil && job.Principal != nil {
+		if authenticators := r.jobAuthenticators(job); len(authenticators) > 0 && !authenticateRequest(c, authenticators) {
+			return nil
+		}
+	}
+	if job == nil || !job.OwnedBy(auth.PrincipalFromContext(c.Request.Context())) && !job.HasToken(c.GetHeader(JobTokenHeader)) {
+		abortWithError(c, http.StatusNotFound, "job not found")
+		return nil
+	}
+	return job
+}
+
+// Authenticators of the route that started job
+func (r *Router) jobAuthenticators(job *jobs.Job) []auth.Authenticator {
+	if route, ok := r.asyncRoutes[job.Route]; ok {
+		return r.routeAuthenticators(route)
+	}
+	return r.config.Authenticators
+}
+
+// Check the requirements of the route that started job again before its result is read
+//
+// Permissions may have been revoked since the job started, aborts the request if so
+func (r *Router) authorizeJob(c *gin.Context, job *jobs.Job) bool {
+	route, ok := r.asyncRoutes[job.Route]
+	if !ok || !route.protected() {
+		return true
+	}
+	return authorizeRequest(c, r.config.Policy, route, job.Params.Get)
+}
+
+// Flags added to the cli commands of async routes
+func asyncFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.BoolFlag{Name: "async", Usage: "run as a background job and print its id, needs a shared job store"},
+		&cli.BoolFlag{Name: "wait", Usage: "run as a background job and wait for its result"},
+	}
+}
+
+// Check whether other processes see the jobs of this one
+func (r *Router) sharedJobStore() bool {
+	_, inMemory := r.jobs.Store().(*jobs.MemoryStore)
+	return !inMemory
+}
+
+// Refuse --async with the in-memory store, the job and its result would be lost with the process
+func (r *Router) checkAsyncFlags(c *cli.Context) error {
+	if c.Bool("async") && !c.Bool("wait") && !r.sharedJobStore() {
+		return cli.Exit("--async needs a shared job store, use --wait", 1)
+	}
+	return nil
+}
+
+// Run the handler of a cli command as a job, an interrupt cancels jobs waited for
+func (r *Router) runCliJob(c *cli.Context, path string, route *Route) error {
+	job, err := r.jobs.Start(c.Context, path, handle.RequestIDFromContext(c.Context), nil,
+		func(ctx context.Context, response *jobs.Response) {
+			jc := *c
+			jc.Context = ctx
+			route.HandleFunc(handle.NewCliAction(&jc), response)
+		})
+	if err != nil {
+		return err
+	}
+	_, _ = fmt.Fprintf(c.App.Writer, "job %s started\n", job.ID)
+	if !c.Bool("wait") {
+		return nil
+	}
+	followed := make(chan struct{})
+	defer close(followed)
+	go func() {
+		select {
+		case <-c.Context.Done():
+			_ = r.jobs.Cancel(job.ID)
+		case <-followed:
+		}
+	}()
+	// followed until the cancelled job finished
+	return r.followJob(utils.Detach(c.Context), c, job.ID)
+}
+
+// Print the status changes of a job and its result until ctx is done
+func (r *Router) followJob(ctx context.Context, c *cli.Context, id string) error {
+	job, err := r.jobs.Follow(ctx, id, jobPollInterval, func(job *jobs.Job) {
+		if job.Progress != nil && !job.Status.Finished() {
+			_, _ = fmt.Fprintf(c.App.Writer, "job %s %s %.0f%% %s\n", job.ID, job.Status, job.Progress.Done(), job.Progress.Message)
+			return
+		}
+		_, _ = fmt.Fprintf(c.App.Writer, "job %s %s\n", job.ID, job.Status)
+	})
+	if err != nil {
+		return err
+	}
+	if job.Code != 0 {
+		resp := handle.NewCliResponse(c)
+		if job.Meta != nil {
+			resp.SetMeta(*job.Meta)
+		}
+		resp.Response(job.Code, job.Result)
+	}
+	return nil
+}
+
+// Command group listing, following and cancelling jobs
+func (r *Router) jobsCommand() *cli.Command {
+	jobID := func(c *cli.Context) (string, error) {
+		if c.NArg() != 1 {
+			return "", errors.New("expected a job id")
+		}
+		return c.Args().First(), nil
+	}
+	return &cli.Command{
+		Name:  "jobs",
+		Usage: "list, follow and cancel background jobs",
+		Subcommands: []*cli.Command{
+			{
+				Name:  "list",
+				Usage: "list all jobs",
+				Action: func(c *cli.Context) error {
+					list, err := r.jobs.Store().List()
+					if err != nil {
+						return err
+					}
+					for _, job := range list {
+						_, _ = fmt.Fprintf(c.App.Writer, "%s\t%s\t%s\t%s\n", job.ID, job.Status, job.Route, job.CreatedAt.Format(time.RFC3339))
+					}
+					return nil
+				},
+			},
+			{
+				Name:      "show",
+				Usage:     "show a job and its result",
+				ArgsUsage: "<id>",
+				Action: func(c *cli.Context) error {
+					id, err := jobID(c)
+					if err != nil {
+						return err
+					}
+					job, err := r.jobs.Store().Get(id)
+					if err != nil {
+						return err
+					}
+					b, err := json.MarshalIndent(job, "", "  ")
+					if err != nil {
+						return err
+					}
+					_, _ = fmt.Fprintln(c.App.Writer, string(b))
+					return nil
+				},
+			},
+			{
+				Name:      "follow",
+				Usage:     "wait for a job and print its result",
+				ArgsUsage: "<id>",
+				Action: func(c *cli.Context) error {
+					id, err := jobID(c)
+					if err != nil {
+						return err
+					}
+					return r.followJob(c.Context, c, id)
+				},
+			},
+			{
+				Name:      "cancel",
+				Usage:     "cancel a running job",
+				ArgsUsage: "<id>",
+				Action: func(c *cli.Context) error {
+					id, err := jobID(c)
+					if err != nil {
+						return err
+					}
+					return r.jobs.Cancel(id)
+				},
+			},
+		},
+	}
+}
@@ -0,0 +1,173 @@
+package acrouter
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/urfave/cli/v2"
+	"github.com/zfs123/go-ac-router/auth"
+	"github.com/zfs123/go-ac-router/handle"
+	"github.com/zfs123/go-ac-router/jobs"
+)
+
+func TestAsyncApiRoute(t *testing.T) {
+	r, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	release := make(chan struct{})
+	r.AddApiRoute("/report", "POST", "build report", nil, nil, func(action handle.Action, response handle.Response) {
+		select {
+		case <-release:
+			response.Response(http.StatusOK, map[string]string{"name": action.String("name")})
+		case <-action.Context().Done():
+		}
+	}, Async())
+
+	w := performRequest(r, "POST", "/report?name=weekly")
+	assert.Equal(t, http.StatusAccepted, w.Code)
+	var accepted struct {
+		JobID     string `json:"job_id"`
+		StatusURL string `json:"status_url"`
+		JobToken  string `json:"job_token"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &accepted))
+	assert.Equal(t, "/jobs/"+accepted.JobID, accepted.StatusURL)
+	token := header{JobTokenHeader, accepted.JobToken}
+	assert.Len(t, accepted.JobToken, 32)
+	assert.Equal(t, http.StatusAccepted, performRequest(r, "GET", accepted.StatusURL+"/result", token).Code)
+	// anonymous jobs are only found with their token
+	assert.Equal(t, http.StatusNotFound, performRequest(r, "GET", accepted.StatusURL).Code)
+	assert.Equal(t, http.StatusNotFound, performRequest(r, "GET", accepted.StatusURL, header{JobTokenHeader, "guess"}).Code)
+	assert.Equal(t, "[]", performRequest(r, "GET", "/jobs").Body.String())
+
+	close(release)
+	job, err := r.Jobs().Follow(context.Background(), accepted.JobID, time.Millisecond, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, jobs.StatusSucceeded, job.Status)
+
+	w = performRequest(r, "GET", accepted.StatusURL+"/result", token)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `{"name":"weekly"}`, w.Body.String())
+
+	w = performRequest(r, "POST", "/report")
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &accepted))
+	assert.Equal(t, http.StatusNotFound, performRequest(r, "DELETE", accepted.StatusURL, token).Code)
+	assert.Equal(t, http.StatusAccepted, performRequest(r, "DELETE", accepted.StatusURL, header{JobTokenHeader, accepted.JobToken}).Code)
+	job, _ = r.Jobs().Follow(context.Background(), accepted.JobID, time.Millisecond, nil)
+	assert.Equal(t, jobs.StatusCancelled, job.Status)
+
+	assert.Equal(t, http.StatusNotFound, performRequest(r, "GET", "/jobs/unknown").Code)
+}
+
+func TestAsyncCliCommand(t *testing.T) {
+	os.Args = []string{"-", "report", "--wait"}
+	r, _ := New()
+	out := &bytes.Buffer{}
+	r.cli.App.Writer = out
+	r.AddMultiRoute("/report", "POST", "build report", nil, nil, func(action handle.Action, response handle.Response) {
+		response.SendSimpleOk("done")
+	}, Async())
+	r.Run()
+
+	assert.Regexp(t, `^job [0-9a-f]{16} started\n(job [0-9a-f]{16} (pending|running)\n)*job [0-9a-f]{16} succeeded\ncode 200,msg \{"code":0,"msg":"done"\}\n$`, out.String())
+}
+
+func TestAsyncJobOwner(t *testing.T) {
+	policy := auth.NewPolicy(
+		map[string][]string{"alice": {"analyst"}, "bob": {"analyst"}},
+		map[string][]string{"analyst": {"reports:run"}},
+	)
+	keys := auth.NewAPIKeyAuthenticator(map[string]string{"ka": "alice", "kb": "bob"})
+	// the job routes authenticate like the route, there are no router authenticators
+	r, err := New(Authorization(policy))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.AddApiRoute("/report/:team", "POST", "build report", nil, nil, func(action handle.Action, response handle.Response) {
+		response.SendSimpleOk("done")
+	}, Async(), Authenticate(keys), Permissions("reports:run"), Rules(auth.ParamMatchesPrincipal("team")))
+
+	w := performRequest(r, "POST", "/report/alice", header{"X-API-Key", "ka"})
+	assert.Equal(t, http.StatusAccepted, w.Code)
+	var accepted struct {
+		JobID     string `json:"job_id"`
+		StatusURL string `json:"status_url"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &accepted))
+	_, err = r.Jobs().Follow(context.Background(), accepted.JobID, time.Millisecond, nil)
+	assert.NoError(t, err)
+
+	w = performRequest(r, "GET", "/jobs", header{"X-API-Key", "kb"})
+	assert.Equal(t, "[]", w.Body.String())
+	assert.Equal(t, http.StatusNotFound, performRequest(r, "GET", accepted.StatusURL, header{"X-API-Key", "kb"}).Code)
+	assert.Equal(t, http.StatusNotFound, performRequest(r, "GET", accepted.StatusURL+"/result", header{"X-API-Key", "kb"}).Code)
+	assert.Equal(t, http.StatusNotFound, performRequest(r, "DELETE", accepted.StatusURL, header{"X-API-Key", "kb"}).Code)
+
+	assert.Equal(t, http.StatusUnauthorized, performRequest(r, "GET", accepted.StatusURL).Code)
+	w = performRequest(r, "GET", "/jobs", header{"X-API-Key", "ka"})
+	assert.Contains(t, w.Body.String(), accepted.JobID)
+	assert.NotContains(t, w.Body.String(), "token")
+	assert.Equal(t, http.StatusOK, performRequest(r, "GET", accepted.StatusURL+"/result", header{"X-API-Key", "ka"}).Code)
+
+	// revoked permissions apply to results of jobs started before
+	policy.RoleBindings["alice"] = nil
+	assert.Equal(t, http.StatusForbidden, performRequest(r, "GET", accepted.StatusURL+"/result", header{"X-API-Key", "ka"}).Code)
+}
+
+func TestAsyncJobTTL(t *testing.T) {
+	r, err := New(JobTTL(50 * time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.AddApiRoute("/report", "POST", "build report", nil, nil, func(action handle.Action, response handle.Response) {
+		response.SendSimpleOk("done")
+	}, Async())
+
+	w := performRequest(r, "POST", "/report")
+	var accepted struct {
+		JobID     string `json:"job_id"`
+		StatusURL string `json:"status_url"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &accepted))
+	job, err := r.Jobs().Follow(context.Background(), accepted.JobID, time.Millisecond, nil)
+	assert.NoError(t, err)
+	assert.NotNil(t, job.ExpiresAt)
+
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, http.StatusNotFound, performRequest(r, "GET", accepted.StatusURL).Code)
+	w = performRequest(r, "GET", "/jobs")
+	assert.Equal(t, "[]", w.Body.String())
+}
+
+func TestAsyncCliFlags(t *testing.T) {
+	r, _ := New()
+	out := &bytes.Buffer{}
+	r.cli.App.Writer = out
+	r.cli.App.ErrWriter = out
+	r.cli.App.ExitErrHandler = func(*cli.Context, error) {}
+	started := make(chan struct{})
+	r.AddMultiRoute("/report", "POST", "build report", nil, nil, func(action handle.Action, response handle.Response) {
+		close(started)
+		<-action.Context().Done()
+	}, Async())
+
+	// the job would be lost with the process
+	err := r.cli.App.Run([]string{"-", "report", "--async"})
+	assert.EqualError(t, err, "--async needs a shared job store, use --wait")
+
+	// an interrupt while waiting cancels the job
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-started
+		cancel()
+	}()
+	assert.NoError(t, r.cli.App.RunContext(ctx, []string{"-", "report", "--wait"}))
+	assert.Regexp(t, `job [0-9a-f]{16} cancelled\n$`, out.String())
+}
@@ -0,0 +1,46 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"net/http"
+)
+
+// DefaultAPIKeyHeader is the header an api key is read from
+const DefaultAPIKeyHeader = "X-API-Key"
+
+// APIKeyAuthenticator accepts static api keys
+type APIKeyAuthenticator struct {
+	// Header the key is read from
+	Header string
+	// Query parameter the key is read from if the header is empty, disabled if empty
+	Query string
+	// key to principal name
+	keys map[string]string
+}
+
+// Create an api key authenticator, keys maps every key to the name of its owner
+func NewAPIKeyAuthenticator(keys map[string]string) *APIKeyAuthenticator {
+	return &APIKeyAuthenticator{Header: DefaultAPIKeyHeader, keys: keys}
+}
+
+// Authenticate by api key
+func (a *APIKeyAuthenticator) Authenticate(r *http.Request) (*Principal, error) {
+	key := r.Header.Get(a.Header)
+	if key == "" && a.Query != "" {
+		key = r.URL.Query().Get(a.Query)
+	}
+	if key == "" {
+		return nil, ErrNoCredentials
+	}
+	for k, name := range a.keys {
+		if subtle.ConstantTimeCompare([]byte(k), []byte(key)) == 1 {
+			return &Principal{Name: name, Method: "api_key"}, nil
+		}
+	}
+	return nil, ErrInvalidCredentials
+}
+
+// Scheme of api keys
+func (a *APIKeyAuthenticator) Scheme() string {
+	return "ApiKey"
+}
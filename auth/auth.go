@@ -0,0 +1,63 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	// ErrNoCredentials is returned when the request carries no credentials for the authenticator
+	ErrNoCredentials = errors.New("no credentials")
+	// ErrInvalidCredentials is returned when the credentials are wrong or expired
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	// ErrForbidden is returned when the credentials are valid but not allowed
+	ErrForbidden = errors.New("forbidden")
+)
+
+// Principal is the authenticated caller of a route
+type Principal struct {
+	Name   string                 `json:"name"`
+	Method string                 `json:"method"`
+	Roles  []string               `json:"roles,omitempty"`
+	Claims map[string]interface{} `json:"claims,omitempty"`
+}
+
+// Authenticator extracts and verifies the credentials of a request
+//
+// ErrNoCredentials must be returned if the request carries no credentials
+// this authenticator understands, so the next one can be tried
+type Authenticator interface {
+	Authenticate(r *http.Request) (*Principal, error)
+	// Scheme used in the WWW-Authenticate header
+	Scheme() string
+}
+
+// Try authenticators in order, the first one finding credentials decides
+func Authenticate(r *http.Request, authenticators ...Authenticator) (*Principal, error) {
+	for _, a := range authenticators {
+		p, err := a.Authenticate(r)
+		if errors.Cause(err) == ErrNoCredentials {
+			continue
+		}
+		return p, err
+	}
+	return nil, ErrNoCredentials
+}
+
+type principalKey struct{}
+
+// Return a copy of ctx carrying the principal
+func ContextWithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// Get the principal stored in ctx, nil if the caller is anonymous
+func PrincipalFromContext(ctx context.Context) *Principal {
+	if ctx == nil {
+		return nil
+	}
+	p, _ := ctx.Value(principalKey{}).(*Principal)
+	return p
+}
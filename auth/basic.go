@@ -0,0 +1,44 @@
+package auth
+
+import (
+	"net/http"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// BasicAuthenticator accepts http basic credentials checked against bcrypt hashes
+type BasicAuthenticator struct {
+	Realm string
+	// user name to bcrypt hash
+	users map[string][]byte
+}
+
+// Create a basic authenticator, users maps every user name to a bcrypt hash of the password
+func NewBasicAuthenticator(users map[string]string) *BasicAuthenticator {
+	a := &BasicAuthenticator{Realm: "Restricted", users: map[string][]byte{}}
+	for name, hash := range users {
+		a.users[name] = []byte(hash)
+	}
+	return a
+}
+
+// Authenticate by user name and password
+func (a *BasicAuthenticator) Authenticate(r *http.Request) (*Principal, error) {
+	name, password, ok := r.BasicAuth()
+	if !ok {
+		return nil, ErrNoCredentials
+	}
+	hash, ok := a.users[name]
+	if !ok {
+		return nil, ErrInvalidCredentials
+	}
+	if bcrypt.CompareHashAndPassword(hash, []byte(password)) != nil {
+		return nil, ErrInvalidCredentials
+	}
+	return &Principal{Name: name, Method: "basic"}, nil
+}
+
+// Scheme of basic auth
+func (a *BasicAuthenticator) Scheme() string {
+	return `Basic realm="` + a.Realm + `"`
+}
@@ -0,0 +1,229 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// JWTConfig configures the validation of bearer tokens
+type JWTConfig struct {
+	// Secret of HS256, HS384 and HS512 tokens
+	Secret []byte
+	// Local JWKS file holding the RSA keys of RS256, RS384 and RS512 tokens
+	JWKSFile string
+	// Required issuer, not checked if empty
+	Issuer string
+	// Required audience, not checked if empty
+	Audience string
+	// Clock skew tolerated when checking exp and nbf
+	Leeway time.Duration
+	// Claim holding the roles of the principal
+	RolesClaim string
+}
+
+// JWTAuthenticator accepts HMAC or RSA signed bearer tokens
+type JWTAuthenticator struct {
+	config  JWTConfig
+	rsaKeys map[string]*rsa.PublicKey
+	now     func() time.Time
+}
+
+// Create a jwt authenticator, the JWKS file is loaded once
+func NewJWTAuthenticator(config JWTConfig) (*JWTAuthenticator, error) {
+	a := &JWTAuthenticator{config: config, rsaKeys: map[string]*rsa.PublicKey{}, now: time.Now}
+	if a.config.RolesClaim == "" {
+		a.config.RolesClaim = "roles"
+	}
+	if config.JWKSFile != "" {
+		keys, err := loadJWKS(config.JWKSFile)
+		if err != nil {
+			return nil, err
+		}
+		a.rsaKeys = keys
+	}
+	if len(config.Secret) == 0 && len(a.rsaKeys) == 0 {
+		return nil, errors.New("jwt authenticator needs a secret or a jwks file")
+	}
+	return a, nil
+}
+
+// Authenticate by bearer token
+func (a *JWTAuthenticator) Authenticate(r *http.Request) (*Principal, error) {
+	header := r.Header.Get("Authorization")
+	if len(header) < 7 || !strings.EqualFold(header[:7], "bearer ") {
+		return nil, ErrNoCredentials
+	}
+	claims, err := a.Verify(strings.TrimSpace(header[7:]))
+	if err != nil {
+		return nil, errors.Wrap(ErrInvalidCredentials, err.Error())
+	}
+	p := &Principal{Method: "jwt", Claims: claims}
+	p.Name, _ = claims["sub"].(string)
+	switch roles := claims[a.config.RolesClaim].(type) {
+	case []interface{}:
+		for _, role := range roles {
+			if s, ok := role.(string); ok {
+				p.Roles = append(p.Roles, s)
+			}
+		}
+	case string:
+		p.Roles = strings.Fields(roles)
+	}
+	return p, nil
+}
+
+// Scheme of bearer tokens
+func (a *JWTAuthenticator) Scheme() string {
+	return "Bearer"
+}
+
+// Check signature and registered claims of token and return its claims
+func (a *JWTAuthenticator) Verify(token string) (map[string]interface{}, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed token")
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, errors.Wrap(err, "malformed header")
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errors.Wrap(err, "malformed signature")
+	}
+	if err := a.verifySignature(header.Alg, header.Kid, parts[0]+"."+parts[1], signature); err != nil {
+		return nil, err
+	}
+	claims := map[string]interface{}{}
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, errors.Wrap(err, "malformed claims")
+	}
+	if err := a.checkClaims(claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+func (a *JWTAuthenticator) verifySignature(alg, kid, signed string, signature []byte) error {
+	hash, ok := map[string]crypto.Hash{
+		"HS256": crypto.SHA256, "HS384": crypto.SHA384, "HS512": crypto.SHA512,
+		"RS256": crypto.SHA256, "RS384": crypto.SHA384, "RS512": crypto.SHA512,
+	}[alg]
+	if !ok {
+		return errors.Errorf("unsupported algorithm %q", alg)
+	}
+	if strings.HasPrefix(alg, "HS") {
+		if len(a.config.Secret) == 0 {
+			return errors.New("hmac tokens are not accepted")
+		}
+		mac := hmac.New(hash.New, a.config.Secret)
+		mac.Write([]byte(signed))
+		if !hmac.Equal(mac.Sum(nil), signature) {
+			return errors.New("invalid signature")
+		}
+		return nil
+	}
+	key, ok := a.rsaKeys[kid]
+	if !ok && kid == "" && len(a.rsaKeys) == 1 {
+		for _, k := range a.rsaKeys {
+			key, ok = k, true
+		}
+	}
+	if !ok {
+		return errors.Errorf("unknown key %q", kid)
+	}
+	h := hash.New()
+	h.Write([]byte(signed))
+	if err := rsa.VerifyPKCS1v15(key, hash, h.Sum(nil), signature); err != nil {
+		return errors.New("invalid signature")
+	}
+	return nil
+}
+
+func (a *JWTAuthenticator) checkClaims(claims map[string]interface{}) error {
+	now := a.now()
+	if exp, ok := claims["exp"].(float64); ok && now.After(time.Unix(int64(exp), 0).Add(a.config.Leeway)) {
+		return errors.New("token is expired")
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now.Add(a.config.Leeway).Before(time.Unix(int64(nbf), 0)) {
+		return errors.New("token is not valid yet")
+	}
+	if a.config.Issuer != "" && claims["iss"] != a.config.Issuer {
+		return errors.New("invalid issuer")
+	}
+	if a.config.Audience != "" && !hasAudience(claims["aud"], a.config.Audience) {
+		return errors.New("invalid audience")
+	}
+	return nil
+}
+
+// aud is either a single string or a list of strings
+func hasAudience(aud interface{}, want string) bool {
+	switch v := aud.(type) {
+	case string:
+		return v == want
+	case []interface{}:
+		for _, a := range v {
+			if a == want {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func decodeSegment(seg string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+// Load the RSA keys of a JWKS file, keyed by kid
+func loadJWKS(path string) (map[string]*rsa.PublicKey, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "read jwks file")
+	}
+	var set struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := json.Unmarshal(b, &set); err != nil {
+		return nil, errors.Wrap(err, "parse jwks file")
+	}
+	keys := map[string]*rsa.PublicKey{}
+	for _, k := range set.Keys {
+		if k.Kty != "RSA" {
+			continue
+		}
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, errors.Wrapf(err, "decode modulus of key %q", k.Kid)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, errors.Wrapf(err, "decode exponent of key %q", k.Kid)
+		}
+		keys[k.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	}
+	return keys, nil
+}
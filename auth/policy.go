@@ -0,0 +1,122 @@
+package auth
+
+import (
+	"strings"
+)
+
+// WildcardPermission grants every permission
+const WildcardPermission = "*"
+
+// Request is what the policy decides on
+type Request struct {
+	Principal *Principal
+	// Method and path of the route, like "DELETE /users/:id"
+	Route string
+	// Permissions required by the route, all of them must be granted
+	Permissions []string
+	// Roles accepted by the route, one of them must be held
+	Roles []string
+	// Get a request parameter by name
+	Param func(name string) string
+	// Roles held by the principal, filled in by the policy
+	HeldRoles []string
+}
+
+// Rule is an attribute based check, it returns a reason if the request is denied
+type Rule func(req *Request) (allowed bool, reason string)
+
+// Decision is the result of an authorization check
+type Decision struct {
+	Allowed bool
+	Reason  string
+}
+
+// Policy decides whether a principal may call a route
+type Policy struct {
+	// principal name to roles, in addition to the roles of the principal
+	RoleBindings map[string][]string
+	// role to granted permissions
+	RolePermissions map[string][]string
+}
+
+// Create a policy from role bindings and role permissions
+func NewPolicy(roleBindings, rolePermissions map[string][]string) *Policy {
+	return &Policy{RoleBindings: roleBindings, RolePermissions: rolePermissions}
+}
+
+// Roles held by p, both carried by the principal and bound by the policy
+func (pol *Policy) Roles(p *Principal) []string {
+	if p == nil {
+		return nil
+	}
+	roles := append([]string(nil), p.Roles...)
+	if pol != nil {
+		roles = append(roles, pol.RoleBindings[p.Name]...)
+	}
+	return roles
+}
+
+// Permissions granted to p through its roles
+func (pol *Policy) Permissions(p *Principal) map[string]bool {
+	granted := map[string]bool{}
+	if pol == nil {
+		return granted
+	}
+	for _, role := range pol.Roles(p) {
+		for _, perm := range pol.RolePermissions[role] {
+			granted[perm] = true
+		}
+	}
+	return granted
+}
+
+// Decide on req, rules are checked after roles and permissions
+func (pol *Policy) Decide(req *Request, rules ...Rule) Decision {
+	if len(req.Permissions) == 0 && len(req.Roles) == 0 && len(rules) == 0 {
+		return Decision{Allowed: true, Reason: "no requirements"}
+	}
+	if req.Principal == nil {
+		return Decision{Reason: "anonymous caller"}
+	}
+	req.HeldRoles = pol.Roles(req.Principal)
+	if len(req.Roles) > 0 && !hasAny(req.HeldRoles, req.Roles) {
+		return Decision{Reason: "missing one of roles " + strings.Join(req.Roles, ", ")}
+	}
+	granted := pol.Permissions(req.Principal)
+	for _, perm := range req.Permissions {
+		if !granted[perm] && !granted[WildcardPermission] {
+			return Decision{Reason: "missing permission " + perm}
+		}
+	}
+	for _, rule := range rules {
+		if allowed, reason := rule(req); !allowed {
+			return Decision{Reason: reason}
+		}
+	}
+	return Decision{Allowed: true, Reason: "granted"}
+}
+
+// Allow only if the request parameter param equals the principal name,
+// principals holding one of bypassRoles are always allowed
+func ParamMatchesPrincipal(param string, bypassRoles ...string) Rule {
+	return func(req *Request) (bool, string) {
+		if hasAny(req.HeldRoles, bypassRoles) {
+			return true, ""
+		}
+		if req.Param != nil && req.Param(param) == req.Principal.Name {
+			return true, ""
+		}
+		return false, "parameter " + param + " does not match the caller"
+	}
+}
+
+func hasAny(held, wanted []string) bool {
+	for _, h := range held {
+		for _, w := range wanted {
+			if h == w {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,58 @@
+package acrouter
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+	"github.com/zfs123/go-ac-router/auth"
+)
+
+// Authenticate the request and attach the principal to its context
+func authMiddleware(authenticators []auth.Authenticator) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if authenticateRequest(c, authenticators) {
+			c.Next()
+		}
+	}
+}
+
+// Attach the principal authenticated by one of authenticators to the request, aborts the request if there is none
+func authenticateRequest(c *gin.Context, authenticators []auth.Authenticator) bool {
+	p, err := auth.Authenticate(c.Request, authenticators...)
+	switch errors.Cause(err) {
+	case nil:
+		c.Request = c.Request.WithContext(auth.ContextWithPrincipal(c.Request.Context(), p))
+		return true
+	case auth.ErrForbidden:
+		abortWithError(c, http.StatusForbidden, "forbidden")
+	case auth.ErrNoCredentials:
+		setChallenge(c, authenticators)
+		abortWithError(c, http.StatusUnauthorized, "authentication required")
+	default:
+		setChallenge(c, authenticators)
+		abortWithError(c, http.StatusUnauthorized, "invalid credentials")
+	}
+	return false
+}
+
+// Announce the accepted schemes in the WWW-Authenticate header
+func setChallenge(c *gin.Context, authenticators []auth.Authenticator) {
+	schemes := make([]string, 0, len(authenticators))
+	for _, a := range authenticators {
+		schemes = append(schemes, a.Scheme())
+	}
+	c.Header("WWW-Authenticate", strings.Join(schemes, ", "))
+}
+
+// Authenticators applying to route
+func (r *Router) routeAuthenticators(route *Route) []auth.Authenticator {
+	if route.Public {
+		return nil
+	}
+	if route.Authenticators != nil {
+		return route.Authenticators
+	}
+	return r.config.Authenticators
+}
@@ -0,0 +1,152 @@
+package acrouter
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zfs123/go-ac-router/auth"
+	"github.com/zfs123/go-ac-router/handle"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func signToken(header, claims map[string]interface{}, sign func(signed []byte) []byte) string {
+	h, _ := json.Marshal(header)
+	c, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(h) + "." + base64.RawURLEncoding.EncodeToString(c)
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sign([]byte(signed)))
+}
+
+func newAuthRouter(t *testing.T, authenticators ...auth.Authenticator) *Router {
+	r, err := New(Authentication(authenticators...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.AddApiRoute("/whoami", "GET", "whoami api", nil, nil, func(action handle.Action, response handle.Response) {
+		response.Response(http.StatusOK, action.Principal().Name)
+	})
+	r.AddApiRoute("/health", "GET", "health api", nil, nil, func(action handle.Action, response handle.Response) {
+		response.SendSimpleOk("ok")
+	}, Public())
+	return r
+}
+
+func TestApiKeyAuthentication(t *testing.T) {
+	r := newAuthRouter(t, auth.NewAPIKeyAuthenticator(map[string]string{"secret-key": "ci"}))
+
+	w := performRequest(r, "GET", "/whoami")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, "ApiKey", w.Header().Get("WWW-Authenticate"))
+	assert.Contains(t, w.Body.String(), `"msg":"authentication required"`)
+
+	w = performRequest(r, "GET", "/whoami", header{"X-API-Key", "wrong"})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = performRequest(r, "GET", "/whoami", header{"X-API-Key", "secret-key"})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `"ci"`, w.Body.String())
+
+	w = performRequest(r, "GET", "/health")
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestBasicAuthentication(t *testing.T) {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("pass"), bcrypt.MinCost)
+	r := newAuthRouter(t, auth.NewBasicAuthenticator(map[string]string{"alice": string(hash)}))
+
+	credentials := func(user, password string) header {
+		return header{"Authorization", "Basic " + base64.StdEncoding.EncodeToString([]byte(user+":"+password))}
+	}
+	w := performRequest(r, "GET", "/whoami", credentials("alice", "wrong"))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = performRequest(r, "GET", "/whoami", credentials("alice", "pass"))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `"alice"`, w.Body.String())
+}
+
+func TestJWTAuthentication(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwks, _ := json.Marshal(map[string]interface{}{"keys": []map[string]string{{
+		"kty": "RSA",
+		"kid": "k1",
+		"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}}})
+	dir, _ := ioutil.TempDir("", "jwks")
+	defer os.RemoveAll(dir)
+	jwksFile := filepath.Join(dir, "jwks.json")
+	assert.NoError(t, ioutil.WriteFile(jwksFile, jwks, 0644))
+
+	secret := []byte("hmac-secret")
+	authenticator, err := auth.NewJWTAuthenticator(auth.JWTConfig{Secret: secret, JWKSFile: jwksFile, Issuer: "test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := newAuthRouter(t, authenticator)
+
+	hs256 := func(signed []byte) []byte {
+		mac := hmac.New(sha256.New, secret)
+		mac.Write(signed)
+		return mac.Sum(nil)
+	}
+	rs256 := func(signed []byte) []byte {
+		sum := sha256.Sum256(signed)
+		sig, _ := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, sum[:])
+		return sig
+	}
+	exp := time.Now().Add(time.Hour).Unix()
+
+	token := signToken(map[string]interface{}{"alg": "HS256"}, map[string]interface{}{"sub": "bob", "iss": "test", "exp": exp}, hs256)
+	w := performRequest(r, "GET", "/whoami", header{"Authorization", "Bearer " + token})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `"bob"`, w.Body.String())
+
+	token = signToken(map[string]interface{}{"alg": "RS256", "kid": "k1"}, map[string]interface{}{"sub": "carol", "iss": "test", "exp": exp}, rs256)
+	w = performRequest(r, "GET", "/whoami", header{"Authorization", "Bearer " + token})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `"carol"`, w.Body.String())
+
+	expired := signToken(map[string]interface{}{"alg": "HS256"}, map[string]interface{}{"sub": "bob", "iss": "test", "exp": time.Now().Add(-time.Hour).Unix()}, hs256)
+	w = performRequest(r, "GET", "/whoami", header{"Authorization", "Bearer " + expired})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Contains(t, w.Body.String(), `"msg":"invalid credentials"`)
+
+	token = signToken(map[string]interface{}{"alg": "RS256", "kid": "k1"}, map[string]interface{}{"sub": "carol", "iss": "other"}, rs256)
+	w = performRequest(r, "GET", "/whoami", header{"Authorization", "Bearer " + token})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestGroupAuthentication(t *testing.T) {
+	r, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	admin := r.Group("/admin", Authenticate(auth.NewAPIKeyAuthenticator(map[string]string{"k": "admin"})))
+	admin.AddApiRoute("/stats", "GET", "stats api", nil, nil, func(action handle.Action, response handle.Response) {
+		response.SendSimpleOk(action.Principal().Name)
+	})
+	r.AddApiRoute("/open", "GET", "open api", nil, nil, func(action handle.Action, response handle.Response) {
+		response.SendSimpleOk("open")
+	})
+
+	assert.Equal(t, http.StatusUnauthorized, performRequest(r, "GET", "/admin/stats").Code)
+	assert.Equal(t, http.StatusOK, performRequest(r, "GET", "/admin/stats", header{"X-API-Key", "k"}).Code)
+	assert.Equal(t, http.StatusOK, performRequest(r, "GET", "/open").Code)
+	assert.Len(t, r.Routes(), 2)
+}
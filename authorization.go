@@ -0,0 +1,98 @@
+package acrouter
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/zfs123/go-ac-router/auth"
+	"github.com/zfs123/go-ac-router/handle"
+	"go.uber.org/zap"
+)
+
+// Require all permissions for calling the route
+func Permissions(permissions ...string) RouteOption {
+	return func(route *Route) {
+		route.Permissions = append(route.Permissions, permissions...)
+	}
+}
+
+// Require one of roles for calling the route
+func Roles(roles ...string) RouteOption {
+	return func(route *Route) {
+		route.Roles = append(route.Roles, roles...)
+	}
+}
+
+// Check attribute rules on every call of the route
+func Rules(rules ...auth.Rule) RouteOption {
+	return func(route *Route) {
+		route.Rules = append(route.Rules, rules...)
+	}
+}
+
+// Check whether the route declares authorization requirements
+func (route *Route) protected() bool {
+	return len(route.Permissions) > 0 || len(route.Roles) > 0 || len(route.Rules) > 0
+}
+
+// Human readable requirements of the route, empty if there are none
+func (route *Route) Requirements() string {
+	var lines []string
+	if len(route.Permissions) > 0 {
+		lines = append(lines, "Requires permissions: "+strings.Join(route.Permissions, ", "))
+	}
+	if len(route.Roles) > 0 {
+		lines = append(lines, "Requires one of roles: "+strings.Join(route.Roles, ", "))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Enforce the declared requirements of route with policy and log the decision
+func authorizeMiddleware(policy *auth.Policy, route *Route) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		action := handle.NewApiAction(c)
+		param := func(key string) string {
+			if v := c.Param(key); v != "" {
+				return v
+			}
+			return action.String(key)
+		}
+		if authorizeRequest(c, policy, route, param) {
+			c.Next()
+		}
+	}
+}
+
+// Decide whether the caller may use route with the given parameters, aborts the request if not
+func authorizeRequest(c *gin.Context, policy *auth.Policy, route *Route, param func(key string) string) bool {
+	action := handle.NewApiAction(c)
+	name := route.Method + " " + route.Path
+	req := &auth.Request{
+		Principal:   action.Principal(),
+		Route:       name,
+		Permissions: route.Permissions,
+		Roles:       route.Roles,
+		Param:       param,
+	}
+	decision := policy.Decide(req, route.Rules...)
+	principal := ""
+	if req.Principal != nil {
+		principal = req.Principal.Name
+	}
+	action.Logger().Info("authorization decision",
+		zap.String("route", name),
+		zap.String("principal", principal),
+		zap.Bool("allowed", decision.Allowed),
+		zap.String("reason", decision.Reason),
+	)
+	switch {
+	case decision.Allowed:
+		return true
+	case req.Principal == nil:
+		abortWithError(c, http.StatusUnauthorized, "authentication required")
+	default:
+		abortWithError(c, http.StatusForbidden, "forbidden: "+decision.Reason)
+	}
+	return false
+}
@@ -0,0 +1,50 @@
+package acrouter
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zfs123/go-ac-router/auth"
+	"github.com/zfs123/go-ac-router/handle"
+)
+
+func TestAuthorization(t *testing.T) {
+	policy := auth.NewPolicy(
+		map[string][]string{"alice": {"admin"}, "bob": {"viewer"}},
+		map[string][]string{"admin": {"*"}, "viewer": {"users:read"}},
+	)
+	keys := auth.NewAPIKeyAuthenticator(map[string]string{"ka": "alice", "kb": "bob"})
+	r, err := New(Authentication(keys), Authorization(policy))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ok := func(action handle.Action, response handle.Response) {
+		response.SendSimpleOk("ok")
+	}
+	r.AddApiRoute("/users", "GET", "list users", nil, nil, ok, Permissions("users:read"))
+	r.AddApiRoute("/users", "DELETE", "delete users", nil, nil, ok, Permissions("users:delete"))
+	r.AddApiRoute("/profile/:name", "GET", "show profile", nil, nil, ok, Rules(auth.ParamMatchesPrincipal("name", "admin")))
+
+	assert.Equal(t, http.StatusOK, performRequest(r, "GET", "/users", header{"X-API-Key", "kb"}).Code)
+	w := performRequest(r, "DELETE", "/users", header{"X-API-Key", "kb"})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Contains(t, w.Body.String(), "missing permission users:delete")
+	assert.Equal(t, http.StatusOK, performRequest(r, "DELETE", "/users", header{"X-API-Key", "ka"}).Code)
+
+	assert.Equal(t, http.StatusOK, performRequest(r, "GET", "/profile/bob", header{"X-API-Key", "kb"}).Code)
+	assert.Equal(t, http.StatusForbidden, performRequest(r, "GET", "/profile/alice", header{"X-API-Key", "kb"}).Code)
+	assert.Equal(t, http.StatusOK, performRequest(r, "GET", "/profile/bob", header{"X-API-Key", "ka"}).Code)
+}
+
+func TestRouteRequirementsInCliHelp(t *testing.T) {
+	r, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.AddMultiRoute("/purge", "POST", "purge cache", nil, nil, func(action handle.Action, response handle.Response) {},
+		Permissions("cache:purge"), Roles("ops"))
+
+	command := r.cli.App.Commands[0]
+	assert.Equal(t, "Requires permissions: cache:purge\nRequires one of roles: ops", command.Description)
+}
@@ -0,0 +1,105 @@
+package acrouter
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/zfs123/go-ac-router/handle"
+)
+
+// DefaultBatchPath is the path of the batch endpoint if none is given
+const DefaultBatchPath = "/batch"
+
+// DefaultBatchMaxRequests is the number of sub-requests a batch may hold if no limit is given
+const DefaultBatchMaxRequests = 50
+
+// batchRequest is a sub-request of a batch
+type batchRequest struct {
+	Method string          `json:"method"`
+	Path   string          `json:"path"`
+	Params json.RawMessage `json:"params"`
+}
+
+// batchResult is the response to a sub-request
+type batchResult struct {
+	Status  int               `json:"status"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    interface{}       `json:"body"`
+}
+
+// Answer an array of sub-requests with an array of their results in the same order
+//
+// Every sub-request goes through the engine like a request of its own, so
+// authentication, authorization and rate limits apply to each of them.
+func (r *Router) batchHandler() gin.HandlerFunc {
+	concurrency := r.config.BatchConcurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	return func(c *gin.Context) {
+		var requests []batchRequest
+		if err := json.NewDecoder(c.Request.Body).Decode(&requests); err != nil {
+			abortWithError(c, http.StatusBadRequest, "body must be an array of requests")
+			return
+		}
+		if len(requests) == 0 {
+			abortWithError(c, http.StatusBadRequest, "batch is empty")
+			return
+		}
+		if len(requests) > r.config.BatchMaxRequests {
+			abortWithError(c, http.StatusRequestEntityTooLarge, "batch holds too many requests")
+			return
+		}
+
+		results := make([]batchResult, len(requests))
+		slots := make(chan struct{}, concurrency)
+		var wg sync.WaitGroup
+		for i := range requests {
+			wg.Add(1)
+			slots <- struct{}{}
+			go func(i int) {
+				defer wg.Done()
+				defer func() { <-slots }()
+				results[i] = r.batchCall(c.Request, requests[i])
+			}(i)
+		}
+		wg.Wait()
+		c.JSON(http.StatusOK, results)
+	}
+}
+
+// Dispatch one sub-request in process
+func (r *Router) batchCall(parent *http.Request, br batchRequest) batchResult {
+	fail := func(code int, msg string) batchResult {
+		return batchResult{Status: code, Body: handle.ErrorBody(parent.Context(), code, msg)}
+	}
+	method := strings.ToUpper(br.Method)
+	if method == "" {
+		method = http.MethodGet
+	}
+	if br.Path == r.config.BatchPath || strings.HasPrefix(br.Path, r.config.BatchPath+"?") {
+		return fail(http.StatusBadRequest, "batches can not be nested")
+	}
+	values, err := rpcValues(br.Params)
+	if err != nil {
+		return fail(http.StatusBadRequest, err.Error())
+	}
+	req, err := r.newSubRequest(parent.Context(), method, br.Path, values, parent)
+	if err != nil {
+		return fail(http.StatusBadRequest, err.Error())
+	}
+	rr := r.dispatch(req)
+	result := batchResult{Status: rr.status(), Body: decodeBody(rr.body.Bytes())}
+	for k, v := range rr.header {
+		if len(v) > 0 && k != "Content-Type" && k != "Content-Length" {
+			if result.Headers == nil {
+				result.Headers = map[string]string{}
+			}
+			result.Headers[k] = v[0]
+		}
+	}
+	return result
+}
@@ -0,0 +1,99 @@
+package acrouter
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/zfs123/go-ac-router/auth"
+	"github.com/zfs123/go-ac-router/handle"
+)
+
+func performBatch(r *Router, body string, headers ...header) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", DefaultBatchPath, strings.NewReader(body))
+	req.RemoteAddr = "10.0.0.1:1234"
+	for _, h := range headers {
+		req.Header.Add(h.Key, h.Value)
+	}
+	w := httptest.NewRecorder()
+	r.api.Engine.ServeHTTP(w, req)
+	return w
+}
+
+func TestBatch(t *testing.T) {
+	r, err := New(Batch("", 2, 3), Authentication(auth.NewAPIKeyAuthenticator(map[string]string{"secret": "alice"})))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.AddApiRoute("/users/:id", "GET", "show user", nil, nil, func(action handle.Action, response handle.Response) {
+		response.Response(http.StatusOK, gin.H{"id": action.(*handle.ApiAction).C.Param("id"), "by": action.Principal().Name, "q": action.String("q")})
+	})
+	r.AddApiRoute("/greet", "POST", "greet someone", &greetParams{}, nil, func(action handle.Action, response handle.Response) {
+		response.Response(http.StatusCreated, gin.H{"greeting": "hello " + action.String("name")})
+	}, Public(), RateLimit(0.001, 1, ByClientIP))
+
+	w := performBatch(r, `[
+		{"method": "GET", "path": "/users/7?q=a", "params": {"q": "b"}},
+		{"method": "post", "path": "/greet", "params": {"name": "bob"}},
+		{"method": "POST", "path": "/greet", "params": {"name": "eve"}}
+	]`, header{"X-API-Key", "secret"})
+	assert.Equal(t, http.StatusOK, w.Code)
+	var results []batchResult
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &results))
+	assert.Len(t, results, 3)
+	assert.Equal(t, http.StatusOK, results[0].Status)
+	assert.Equal(t, map[string]interface{}{"id": "7", "by": "alice", "q": "a"}, results[0].Body)
+	statuses := []int{results[1].Status, results[2].Status}
+	assert.ElementsMatch(t, []int{http.StatusCreated, http.StatusTooManyRequests}, statuses)
+
+	w = performBatch(r, `[{"path": "/users/7"}, {"path": "/batch"}, {"path": "users"}]`)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &results))
+	assert.Equal(t, http.StatusUnauthorized, results[0].Status)
+	assert.Equal(t, http.StatusBadRequest, results[1].Status)
+	assert.Equal(t, http.StatusBadRequest, results[2].Status)
+
+	assert.Equal(t, http.StatusRequestEntityTooLarge, performBatch(r, `[{},{},{},{}]`).Code)
+	assert.Equal(t, http.StatusBadRequest, performBatch(r, `[]`).Code)
+	assert.Equal(t, http.StatusBadRequest, performBatch(r, `{}`).Code)
+}
+
+func TestBatchConcurrency(t *testing.T) {
+	r, _ := New(Batch("", 2, 0))
+	var running, peak int32
+	r.AddApiRoute("/work", "GET", "do work", nil, nil, func(action handle.Action, response handle.Response) {
+		n := atomic.AddInt32(&running, 1)
+		for {
+			p := atomic.LoadInt32(&peak)
+			if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		atomic.AddInt32(&running, -1)
+		response.SendSimpleOk("done")
+	})
+
+	w := performBatch(r, `[{"path":"/work"},{"path":"/work"},{"path":"/work"},{"path":"/work"},{"path":"/work"}]`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&peak))
+}
+
+func TestBatchBodyLimit(t *testing.T) {
+	r, err := New(Batch("", 1, 0), RequestLimits(http.DefaultMaxHeaderBytes, 64))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.AddApiRoute("/ping", "GET", "ping", nil, nil, func(action handle.Action, response handle.Response) {
+		response.SendSimpleOk("pong")
+	})
+
+	assert.Equal(t, http.StatusOK, performBatch(r, `[{"path": "/ping"}]`).Code)
+	w := performBatch(r, `[{"path": "/ping", "params": {"pad": "`+strings.Repeat("x", 100)+`"}}]`)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+}
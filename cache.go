@@ -0,0 +1,133 @@
+package acrouter
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+	"github.com/zfs123/go-ac-router/handle"
+)
+
+// errUnknownVersion is answered to conditional changes of resources without a VersionFunc
+var errUnknownVersion = errors.New("current version of the resource is unknown")
+
+// VersionFunc returns the current version of the resource of a request, nil if it does not exist
+type VersionFunc func(c *gin.Context) (*handle.Version, error)
+
+// Set the Cache-Control header and the kind of etags of successful reads of the route
+func Cache(policy handle.CachePolicy) RouteOption {
+	return func(route *Route) {
+		route.Cache = &policy
+	}
+}
+
+// Look up the current version of the resource before the handler runs,
+// reads the client has already are answered with 304 without running it
+// and changes are checked against it
+func Versioned(fn VersionFunc) RouteOption {
+	return func(route *Route) {
+		route.Version = fn
+	}
+}
+
+// Evaluate the conditional headers of a request
+//
+// Reads are answered with 304 if the version of the route matches, changes
+// get 412 if If-Match or If-Unmodified-Since do not hold for the current
+// version, which comes from the route or from the read route of the same path.
+// Changes of resources without a VersionFunc get 412 for these headers.
+// If-None-Match of a change is only evaluated against the version of the
+// resource itself, a POST is not checked against the version of its collection.
+func (r *Router) conditionalMiddleware(route *Route) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if route.Cache != nil {
+			c.Request = c.Request.WithContext(handle.ContextWithCachePolicy(c.Request.Context(), route.Cache))
+		}
+		switch c.Request.Method {
+		case http.MethodGet, http.MethodHead:
+			if route.Version == nil {
+				c.Next()
+				return
+			}
+			version, err := route.Version(c)
+			if err != nil {
+				abortWithError(c, http.StatusInternalServerError, err.Error())
+				return
+			}
+			if version == nil {
+				c.Next()
+				return
+			}
+			if handle.NotModified(c.Request, version.Tag(), version.ModTime) {
+				handle.SetCacheHeaders(c.Writer.Header(), route.Cache, version.Tag(), version.ModTime)
+				c.AbortWithStatus(http.StatusNotModified)
+				return
+			}
+			c.Request = c.Request.WithContext(handle.ContextWithVersion(c.Request.Context(), version))
+		case http.MethodOptions:
+		default:
+			header := c.Request.Header
+			ifMatch := header.Get("If-Match") != "" || header.Get("If-Unmodified-Since") != ""
+			ifNoneMatch := header.Get("If-None-Match") != ""
+			if !ifMatch && !ifNoneMatch {
+				break
+			}
+			fn, own := r.versionFunc(route)
+			req := c.Request
+			if ifNoneMatch && (fn == nil || !own) {
+				if !ifMatch {
+					break
+				}
+				// If-None-Match is about the resource itself, which has no version here
+				req = new(http.Request)
+				*req = *c.Request
+				req.Header = header.Clone()
+				req.Header.Del("If-None-Match")
+			}
+			if fn == nil {
+				abortWithError(c, http.StatusPreconditionFailed, errUnknownVersion.Error())
+				return
+			}
+			version, err := fn(c)
+			if err != nil {
+				abortWithError(c, http.StatusInternalServerError, err.Error())
+				return
+			}
+			var etag string
+			var modTime time.Time
+			if version != nil {
+				etag, modTime = version.Tag(), version.ModTime
+			}
+			if !handle.PreconditionHolds(req, etag, modTime, version != nil) {
+				abortWithError(c, http.StatusPreconditionFailed, "precondition failed")
+				return
+			}
+		}
+		c.Next()
+	}
+}
+
+// VersionFunc of the resource a change applies to, from the route or from the read route of its path
+//
+// own is false if the version is the one of the collection a POST adds to
+func (r *Router) versionFunc(route *Route) (fn VersionFunc, own bool) {
+	if route.Version != nil {
+		return route.Version, true
+	}
+	read := r.readRoute(route.Path)
+	if read == nil {
+		return nil, false
+	}
+	return read.Version, route.Method != http.MethodPost
+}
+
+// The GET route registered for path, nil if there is none
+func (r *Router) readRoute(path string) *Route {
+	for _, route := range r.routes {
+		if route.Path == path && route.Method == http.MethodGet {
+			return route
+		}
+	}
+	return nil
+}
@@ -0,0 +1,145 @@
+package acrouter
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/zfs123/go-ac-router/handle"
+)
+
+type docParams struct {
+	Body string `form:"body"`
+}
+
+func TestETag(t *testing.T) {
+	r, _ := New(ResponseEnvelope(nil))
+	r.AddApiRoute("/report", "GET", "report", nil, nil, func(action handle.Action, response handle.Response) {
+		response.Response(http.StatusOK, gin.H{"total": 3})
+	}, Cache(handle.CachePolicy{CacheControl: "private, max-age=60"}))
+	r.AddApiRoute("/weak", "GET", "weak", nil, nil, func(action handle.Action, response handle.Response) {
+		response.Response(http.StatusOK, "same")
+	}, Cache(handle.CachePolicy{WeakETag: true}))
+	r.AddApiRoute("/versioned", "GET", "versioned", nil, nil, func(action handle.Action, response handle.Response) {
+		response.SetVersion(handle.Version{ETag: "v7"})
+		response.Response(http.StatusOK, "doc")
+	})
+
+	w := performRequest(r, "GET", "/report")
+	etag := w.Header().Get("ETag")
+	assert.Regexp(t, `^"[A-Za-z0-9_-]{22}"$`, etag)
+	assert.Equal(t, "private, max-age=60", w.Header().Get("Cache-Control"))
+
+	// the request id of the envelope differs, the etag does not
+	w = performRequest(r, "GET", "/report", header{"If-None-Match", `"other", ` + etag})
+	assert.Equal(t, http.StatusNotModified, w.Code)
+	assert.Empty(t, w.Body.String())
+	assert.Equal(t, etag, w.Header().Get("ETag"))
+	assert.Equal(t, "private, max-age=60", w.Header().Get("Cache-Control"))
+
+	w = performRequest(r, "GET", "/report?format=xml", header{"If-None-Match", etag})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotEqual(t, etag, w.Header().Get("ETag"))
+	// tagged in the format sent, without the request id
+	xmlTag := w.Header().Get("ETag")
+	w = performRequest(r, "GET", "/report?format=xml", header{"If-None-Match", xmlTag})
+	assert.Equal(t, http.StatusNotModified, w.Code)
+	assert.NotEqual(t, xmlTag, performRequest(r, "GET", "/report?format=yaml").Header().Get("ETag"))
+
+	// a shape without meta tags the same bytes as no envelope
+	plain, _ := New()
+	shaped, _ := New(ResponseEnvelope(func(e *handle.Envelope) interface{} { return e.Data }))
+	for _, router := range []*Router{plain, shaped} {
+		router.AddApiRoute("/report", "GET", "report", nil, nil, func(action handle.Action, response handle.Response) {
+			response.Response(http.StatusOK, gin.H{"total": 3})
+		})
+	}
+	assert.Equal(t, performRequest(plain, "GET", "/report?format=xml").Header().Get("ETag"),
+		performRequest(shaped, "GET", "/report?format=xml").Header().Get("ETag"))
+
+	weak := performRequest(r, "GET", "/weak").Header().Get("ETag")
+	assert.True(t, strings.HasPrefix(weak, `W/"`))
+	assert.Equal(t, http.StatusNotModified, performRequest(r, "GET", "/weak", header{"If-None-Match", weak}).Code)
+
+	w = performRequest(r, "GET", "/versioned", header{"If-None-Match", `W/"v7"`})
+	assert.Equal(t, http.StatusNotModified, w.Code)
+	assert.Equal(t, `"v7"`, w.Header().Get("ETag"))
+}
+
+func TestConditionalRequests(t *testing.T) {
+	r, _ := New()
+	doc, version, calls := "first", 1, 0
+	modTime := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	docVersion := func(c *gin.Context) (*handle.Version, error) {
+		return &handle.Version{ETag: doc}, nil
+	}
+	r.AddApiRoute("/docs", "GET", "list docs", nil, nil, func(action handle.Action, response handle.Response) {
+		response.Response(http.StatusOK, []string{doc})
+	}, Versioned(docVersion))
+	r.AddApiRoute("/docs", "POST", "create doc", nil, nil, func(action handle.Action, response handle.Response) {
+		response.Response(http.StatusCreated, "created")
+	})
+	r.AddApiRoute("/docs/:id", "GET", "show doc", nil, nil, func(action handle.Action, response handle.Response) {
+		calls++
+		response.Response(http.StatusOK, doc)
+	}, Versioned(docVersion))
+	r.AddApiRoute("/docs/:id", "PUT", "update doc", &docParams{}, nil, func(action handle.Action, response handle.Response) {
+		doc = action.String("body")
+		response.SendSimpleOk("updated")
+	}, Mutating())
+	r.AddApiRoute("/notes/:id", "GET", "show note", nil, nil, func(action handle.Action, response handle.Response) {
+		calls++
+		response.Response(http.StatusOK, "note")
+	}, Versioned(func(c *gin.Context) (*handle.Version, error) {
+		if c.Param("id") != "n1" {
+			return nil, nil
+		}
+		return &handle.Version{ETag: "n1-" + strconv.Itoa(version), ModTime: modTime}, nil
+	}))
+	r.AddApiRoute("/notes/:id", "DELETE", "delete note", nil, nil, func(action handle.Action, response handle.Response) {
+		version++
+		response.SendSimpleOk("deleted")
+	})
+	r.AddApiRoute("/orphans/:id", "PUT", "update orphan", nil, nil, func(action handle.Action, response handle.Response) {
+		response.SendSimpleOk("updated")
+	})
+
+	etag := performRequest(r, "GET", "/docs/d1").Header().Get("ETag")
+	put := func(path string, headers ...header) int {
+		return performRequest(r, "PUT", path+"?body=second", headers...).Code
+	}
+	assert.Equal(t, http.StatusPreconditionFailed, put("/docs/d1", header{"If-Match", `"stale"`}))
+	assert.Equal(t, "first", doc)
+	assert.Equal(t, http.StatusOK, put("/docs/d1", header{"If-Match", etag}))
+	assert.Equal(t, "second", doc)
+	assert.Equal(t, http.StatusPreconditionFailed, put("/docs/d1", header{"If-Match", etag}))
+	assert.Equal(t, http.StatusPreconditionFailed, put("/docs/d1", header{"If-None-Match", "*"}))
+	assert.Equal(t, http.StatusPreconditionFailed, put("/orphans/o1", header{"If-Match", "*"}))
+	assert.Equal(t, http.StatusOK, put("/orphans/o1", header{"If-None-Match", "*"}))
+	assert.Equal(t, http.StatusOK, put("/orphans/o1"))
+
+	// the version of the collection is not the one of the new doc
+	assert.Equal(t, http.StatusCreated, performRequest(r, "POST", "/docs", header{"If-None-Match", "*"}).Code)
+	assert.Equal(t, http.StatusPreconditionFailed, performRequest(r, "POST", "/docs", header{"If-Match", `"stale"`}).Code)
+
+	calls = 0
+	w := performRequest(r, "GET", "/notes/n1", header{"If-None-Match", `"n1-1"`})
+	assert.Equal(t, http.StatusNotModified, w.Code)
+	assert.Equal(t, "Fri, 02 Jan 2026 03:04:05 GMT", w.Header().Get("Last-Modified"))
+	w = performRequest(r, "GET", "/notes/n1", header{"If-Modified-Since", "Fri, 02 Jan 2026 03:04:05 GMT"})
+	assert.Equal(t, http.StatusNotModified, w.Code)
+	assert.Equal(t, 0, calls)
+	w = performRequest(r, "GET", "/notes/n1")
+	assert.Equal(t, `"n1-1"`, w.Header().Get("ETag"))
+	assert.Equal(t, 1, calls)
+
+	assert.Equal(t, http.StatusPreconditionFailed, performRequest(r, "DELETE", "/notes/n1", header{"If-Match", `"n1-0"`}).Code)
+	assert.Equal(t, http.StatusOK, performRequest(r, "DELETE", "/notes/n1", header{"If-Match", `"n1-1"`}).Code)
+	assert.Equal(t, http.StatusPreconditionFailed, performRequest(r, "DELETE", "/notes/n2", header{"If-Match", "*"}).Code)
+	assert.Equal(t, http.StatusPreconditionFailed, performRequest(r, "DELETE", "/notes/n1",
+		header{"If-Unmodified-Since", "Thu, 01 Jan 2026 00:00:00 GMT"}).Code)
+}
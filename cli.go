@@ -1,7 +1,10 @@
 package acrouter
 
 import (
+	"context"
 	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/urfave/cli/v2"
 )
@@ -11,9 +14,16 @@ type CliServer struct {
 	apiServer     *ApiServer
 	apiCommand    *cli.Command
 	apiTlsCommand *cli.Command
-	cliCommand    *cli.Command
-	docCommand    *cli.Command
-	route         *Router
+	stdioCommand  *cli.Command
+	shellCommand  *cli.Command
+	// completion scripts and the dynamic completion they call
+	completionCommand *cli.Command
+	completeCommand   *cli.Command
+	runScriptCommand  *cli.Command
+	cliCommand        *cli.Command
+	docCommand        *cli.Command
+	route             *Router
+	builtinsAdded     bool
 }
 
 func NewCliServer(apiServer *ApiServer, defaultAction func(context *cli.Context) error) *CliServer {
@@ -42,7 +52,9 @@ func (cs *CliServer) setDefaultCommand() {
 		Aliases: []string{"s"},
 		Usage:   "start a api server",
 		Action: func(c *cli.Context) error {
-			panic(cs.apiServer.Run())
+			if err := cs.apiServer.RunContext(c.Context); err != nil {
+				panic(err)
+			}
 			return nil
 		},
 	}
@@ -51,7 +63,9 @@ func (cs *CliServer) setDefaultCommand() {
 		Aliases: []string{"tls"},
 		Usage:   "start a api tls server",
 		Action: func(c *cli.Context) error {
-			panic(cs.apiServer.RunTLS())
+			if err := cs.apiServer.RunTLSContext(c.Context); err != nil {
+				panic(err)
+			}
 			return nil
 		},
 	}
@@ -64,6 +78,39 @@ func (cs *CliServer) AddCommand(command *cli.Command) {
 
 // Run cli app
 func (cs *CliServer) Run() error {
+	ctx, stop := interruptContext()
+	defer stop()
+	cs.addBuiltinCommands()
+	return cs.App.RunContext(ctx, os.Args)
+}
+
+// Append the server, stdio, shell, script, completion and doc commands after the route commands
+func (cs *CliServer) addBuiltinCommands() {
+	if cs.builtinsAdded {
+		return
+	}
+	cs.builtinsAdded = true
 	cs.App.Commands = append(cs.App.Commands, cs.apiCommand, cs.apiTlsCommand)
-	return cs.App.Run(os.Args)
+	for _, command := range []*cli.Command{cs.stdioCommand, cs.shellCommand, cs.runScriptCommand, cs.completionCommand, cs.completeCommand, cs.docCommand} {
+		if command != nil {
+			cs.App.Commands = append(cs.App.Commands, command)
+		}
+	}
+}
+
+// Create a context cancelled on the first SIGINT or SIGTERM,
+// a second signal terminates the process as usual
+func interruptContext() (context.Context, func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		select {
+		case <-signals:
+		case <-ctx.Done():
+		}
+		signal.Stop(signals)
+		cancel()
+	}()
+	return ctx, cancel
 }
@@ -0,0 +1,369 @@
+package acrouter
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/urfave/cli/v2"
+	"github.com/zfs123/go-ac-router/utils"
+)
+
+// Name of the hidden command the completion scripts call for dynamic values
+const completeCommandName = "__complete"
+
+// CompleteFunc returns the values a flag can take, given the prefix typed so far
+type CompleteFunc func(ctx context.Context, prefix string) []string
+
+// Complete the values of flag by calling fn when the user presses tab
+func Complete(flag string, fn CompleteFunc) RouteOption {
+	return func(route *Route) {
+		if route.Completions == nil {
+			route.Completions = map[string]CompleteFunc{}
+		}
+		route.Completions[flag] = fn
+	}
+}
+
+// completionCommand describes a command in a completion script
+type completionCommand struct {
+	Name        string
+	Names       []string
+	Usage       string
+	Subcommands []string
+	Flags       []completionFlag
+}
+
+// completionFlag describes a flag in a completion script
+type completionFlag struct {
+	Name       string
+	Usage      string
+	TakesValue bool
+	Values     []string
+	File       bool
+	Dynamic    bool
+}
+
+// completionSpec is the data the script templates are executed with
+type completionSpec struct {
+	Program  string
+	Func     string
+	Commands []completionCommand
+}
+
+// Command printing the completion script of a shell
+func (r *Router) completionCommand() *cli.Command {
+	shells := make([]string, 0, len(completionTemplates))
+	for shell := range completionTemplates {
+		shells = append(shells, shell)
+	}
+	sort.Strings(shells)
+	return &cli.Command{
+		Name:      "completion",
+		Usage:     "print the completion script of a shell",
+		ArgsUsage: "<" + strings.Join(shells, "|") + ">",
+		Description: "Load the script in the shell, for example\n" +
+			"   bash:       source <(app completion bash)\n" +
+			"   zsh:        app completion zsh > \"${fpath[1]}/_app\"\n" +
+			"   fish:       app completion fish > ~/.config/fish/completions/app.fish\n" +
+			"   powershell: app completion powershell | Out-String | Invoke-Expression",
+		Action: func(c *cli.Context) error {
+			tmpl, ok := completionTemplates[c.Args().First()]
+			if !ok {
+				return cli.Exit("expected one of "+strings.Join(shells, ", "), 1)
+			}
+			return tmpl.Execute(c.App.Writer, r.completionSpec(c.App))
+		},
+	}
+}
+
+// Hidden command printing the dynamic values of a flag, one per line
+func (r *Router) completeCommand() *cli.Command {
+	return &cli.Command{
+		Name:      completeCommandName,
+		Hidden:    true,
+		ArgsUsage: "<command> <flag> [prefix]",
+		Action: func(c *cli.Context) error {
+			route := r.commandRoutes[c.Args().Get(0)]
+			if route == nil {
+				return nil
+			}
+			fn := route.Completions[c.Args().Get(1)]
+			if fn == nil {
+				return nil
+			}
+			prefix := c.Args().Get(2)
+			for _, value := range fn(c.Context, prefix) {
+				if strings.HasPrefix(value, prefix) {
+					_, _ = fmt.Fprintln(c.App.Writer, value)
+				}
+			}
+			return nil
+		},
+	}
+}
+
+var nonIdentifier = regexp.MustCompile(`[^A-Za-z0-9_]`)
+
+// Describe the visible commands of app and their flags
+func (r *Router) completionSpec(app *cli.App) completionSpec {
+	spec := completionSpec{Program: app.Name, Func: "_" + nonIdentifier.ReplaceAllString(app.Name, "_")}
+	for _, command := range app.VisibleCommands() {
+		cc := completionCommand{Name: command.Name, Names: uniqueNames(command.Names()), Usage: command.Usage}
+		for _, sub := range command.Subcommands {
+			if !sub.Hidden {
+				cc.Subcommands = append(cc.Subcommands, sub.Name)
+			}
+		}
+		route := r.commandRoutes[command.Name]
+		for _, flag := range command.Flags {
+			// the help flag cli adds to commands once they ran
+			if flag == cli.HelpFlag {
+				continue
+			}
+			cc.Flags = append(cc.Flags, describeFlag(flag, route))
+		}
+		spec.Commands = append(spec.Commands, cc)
+	}
+	return spec
+}
+
+func describeFlag(flag cli.Flag, route *Route) completionFlag {
+	cf := completionFlag{Name: flag.Names()[0]}
+	if doc, ok := flag.(cli.DocGenerationFlag); ok {
+		cf.Usage = doc.GetUsage()
+		cf.TakesValue = doc.TakesValue()
+	}
+	switch f := flag.(type) {
+	case *cli.StringFlag:
+		cf.File = f.TakesFile
+	case *cli.PathFlag:
+		cf.File = true
+	}
+	if route == nil || !cf.TakesValue {
+		return cf
+	}
+	if field, ok := utils.FindField(route.Params, cf.Name); ok {
+		cf.Values = utils.GetEnum(field)
+		cf.File = cf.File || utils.IsFile(field)
+	}
+	cf.Dynamic = route.Completions[cf.Name] != nil
+	return cf
+}
+
+func uniqueNames(names []string) []string {
+	var unique []string
+	seen := map[string]bool{}
+	for _, name := range names {
+		if !seen[name] {
+			seen[name] = true
+			unique = append(unique, name)
+		}
+	}
+	return unique
+}
+
+// Quote s for a single quoted shell string
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+// Quote s for a single quoted powershell string
+func powershellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", "''", -1) + "'"
+}
+
+// Escape the characters zsh gives a meaning in descriptions
+func zshEscape(s string) string {
+	return strings.NewReplacer("'", `'\''`, "[", `\[`, "]", `\]`, ":", `\:`).Replace(s)
+}
+
+func firstLine(s string) string {
+	if i := strings.IndexByte(s, '\n'); i >= 0 {
+		return s[:i]
+	}
+	return s
+}
+
+var completionFuncs = template.FuncMap{
+	"join":      strings.Join,
+	"quote":     shellQuote,
+	"psquote":   powershellQuote,
+	"zsh":       zshEscape,
+	"firstLine": firstLine,
+	"complete":  func() string { return completeCommandName },
+	// names of all commands
+	"allNames": func(commands []completionCommand) []string {
+		var names []string
+		for _, command := range commands {
+			names = append(names, command.Names...)
+		}
+		return names
+	},
+	// subcommands and flags completed after a command
+	"words": func(command completionCommand) []string {
+		words := append([]string(nil), command.Subcommands...)
+		for _, flag := range command.Flags {
+			words = append(words, "--"+flag.Name)
+		}
+		return words
+	},
+	"psjoin": func(values []string) string {
+		quoted := make([]string, len(values))
+		for i, v := range values {
+			quoted[i] = powershellQuote(v)
+		}
+		return strings.Join(quoted, ", ")
+	},
+}
+
+var completionTemplates = map[string]*template.Template{
+	"bash":       template.Must(template.New("bash").Funcs(completionFuncs).Parse(bashCompletion)),
+	"zsh":        template.Must(template.New("zsh").Funcs(completionFuncs).Parse(zshCompletion)),
+	"fish":       template.Must(template.New("fish").Funcs(completionFuncs).Parse(fishCompletion)),
+	"powershell": template.Must(template.New("powershell").Funcs(completionFuncs).Parse(powershellCompletion)),
+}
+
+const bashCompletion = `# bash completion for {{.Program}}
+{{.Func}}() {
+    local cur prev
+    cur="${COMP_WORDS[COMP_CWORD]}"
+    prev="${COMP_WORDS[COMP_CWORD-1]}"
+    if [[ ${COMP_CWORD} -eq 1 ]]; then
+        COMPREPLY=( $(compgen -W {{quote (join (allNames .Commands) " ")}} -- "${cur}") )
+        return
+    fi
+    case "${COMP_WORDS[1]}" in
+{{- range .Commands}}
+    {{join .Names "|"}})
+        case "${prev}" in
+{{- $cmd := .Name}}
+{{- range .Flags}}{{if .TakesValue}}
+        --{{.Name}})
+{{- if .Dynamic}}
+            COMPREPLY=( $(compgen -W "$({{$.Program}} {{complete}} {{$cmd}} {{.Name}} "${cur}" 2>/dev/null)" -- "${cur}") )
+{{- else if .Values}}
+            COMPREPLY=( $(compgen -W {{quote (join .Values " ")}} -- "${cur}") )
+{{- else if .File}}
+            COMPREPLY=( $(compgen -f -- "${cur}") )
+{{- else}}
+            COMPREPLY=()
+{{- end}}
+            return
+            ;;
+{{- end}}{{end}}
+        esac
+        COMPREPLY=( $(compgen -W {{quote (join (words .) " ")}} -- "${cur}") )
+        ;;
+{{- end}}
+    esac
+}
+complete -o default -F {{.Func}} {{.Program}}
+`
+
+const zshCompletion = `#compdef {{.Program}}
+# zsh completion for {{.Program}}
+{{.Func}}() {
+    local -a commands
+    commands=(
+{{- range .Commands}}{{$usage := zsh (firstLine .Usage)}}{{range .Names}}
+        '{{zsh .}}:{{$usage}}'
+{{- end}}{{end}}
+    )
+    if (( CURRENT == 2 )); then
+        _describe 'command' commands
+        return
+    fi
+    shift words
+    (( CURRENT-- ))
+    case "${words[1]}" in
+{{- range .Commands}}
+    {{join .Names "|"}})
+{{- $cmd := .Name}}
+        _arguments \
+{{- range .Flags}}
+            '--{{.Name}}[{{zsh (firstLine .Usage)}}]{{if .TakesValue}}:{{.Name}}:
+{{- if .Dynamic}}{compadd -- ${(f)"$({{$.Program}} {{complete}} {{$cmd}} {{.Name}} "$PREFIX" 2>/dev/null)"}}
+{{- else if .Values}}({{join .Values " "}})
+{{- else if .File}}_files
+{{- else}} {{end}}{{end}}' \
+{{- end}}
+{{- if .Subcommands}}
+            '1:command:({{join .Subcommands " "}})' \
+{{- end}}
+            '*:argument:_files'
+        ;;
+{{- end}}
+    esac
+}
+compdef {{.Func}} {{.Program}}
+`
+
+const fishCompletion = `# fish completion for {{.Program}}
+complete -c {{.Program}} -f
+{{- range .Commands}}
+complete -c {{$.Program}} -n '__fish_use_subcommand' -a {{quote .Name}} -d {{quote (firstLine .Usage)}}
+{{- $cmd := .Name}}{{$cond := join .Names " "}}
+{{- range .Subcommands}}
+complete -c {{$.Program}} -n '__fish_seen_subcommand_from {{$cond}}' -a {{quote .}}
+{{- end}}
+{{- range .Flags}}
+complete -c {{$.Program}} -n '__fish_seen_subcommand_from {{$cond}}' -l {{.Name}} -d {{quote (firstLine .Usage)}}
+{{- if .TakesValue}}
+{{- if .Dynamic}} -x -a '({{$.Program}} {{complete}} {{$cmd}} {{.Name}} (commandline -ct))'
+{{- else if .Values}} -x -a {{quote (join .Values " ")}}
+{{- else if .File}} -r -F
+{{- else}} -x
+{{- end}}{{end}}
+{{- end}}
+{{- end}}
+`
+
+const powershellCompletion = `# powershell completion for {{.Program}}
+Register-ArgumentCompleter -Native -CommandName {{psquote .Program}} -ScriptBlock {
+    param($wordToComplete, $commandAst, $cursorPosition)
+    $words = @($commandAst.CommandElements | Select-Object -Skip 1 | ForEach-Object { $_.ToString() })
+    if ($wordToComplete -ne '' -and $words.Count -gt 0) {
+        $words = @($words | Select-Object -First ($words.Count - 1))
+    }
+    $candidates = @()
+    if ($words.Count -eq 0) {
+        $candidates = @({{psjoin (allNames .Commands)}})
+    } else {
+        $prev = $words[-1]
+        switch ($words[0]) {
+{{- range .Commands}}
+            { @({{psjoin .Names}}) -contains $_ } {
+{{- $cmd := .Name}}
+                switch ($prev) {
+{{- range .Flags}}{{if .TakesValue}}
+                    {{psquote (printf "--%s" .Name)}} {
+{{- if .Dynamic}}
+                        $candidates = @(& {{psquote $.Program}} {{complete}} {{psquote $cmd}} {{psquote .Name}} $wordToComplete)
+                        break
+{{- else if .Values}}
+                        $candidates = @({{psjoin .Values}})
+                        break
+{{- else}}
+                        # fall back to path completion
+                        return
+{{- end}}
+                    }
+{{- end}}{{end}}
+                    default {
+                        $candidates = @({{psjoin (words .)}})
+                    }
+                }
+                break
+            }
+{{- end}}
+        }
+    }
+    $candidates | Where-Object { $_ -like "$wordToComplete*" } | ForEach-Object {
+        [System.Management.Automation.CompletionResult]::new($_, $_, 'ParameterValue', $_)
+    }
+}
+`
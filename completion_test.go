@@ -0,0 +1,49 @@
+package acrouter
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zfs123/go-ac-router/handle"
+)
+
+type paintParams struct {
+	Color string `form:"color" binding:"required,oneof=red green blue" description:"color to paint"`
+	Input string `form:"input" file:"true" description:"file with the layout"`
+	Owner string `form:"owner" description:"owner of the wall"`
+}
+
+func runCompletion(args ...string) string {
+	os.Args = append([]string{"app"}, args...)
+	r, _ := New()
+	r.cli.App.Name = "app"
+	out := &bytes.Buffer{}
+	r.cli.App.Writer = out
+	r.AddMultiRoute("/paint", "POST", "paint a wall", &paintParams{}, nil, func(handle.Action, handle.Response) {},
+		Complete("owner", func(ctx context.Context, prefix string) []string {
+			return []string{"alice", "bob", "bert"}
+		}))
+	r.Run()
+	return out.String()
+}
+
+func TestCompletionScripts(t *testing.T) {
+	bash := runCompletion("completion", "bash")
+	assert.Contains(t, bash, "complete -o default -F _app app")
+	assert.Contains(t, bash, `COMPREPLY=( $(compgen -W 'red green blue' -- "${cur}") )`)
+	assert.Contains(t, bash, `--input)
+            COMPREPLY=( $(compgen -f -- "${cur}") )`)
+	assert.Contains(t, bash, `$(app __complete paint owner "${cur}" 2>/dev/null)`)
+
+	assert.Contains(t, runCompletion("completion", "zsh"), `'--color[color to paint]:color:(red green blue)'`)
+	assert.Contains(t, runCompletion("completion", "fish"), `-l input -d 'file with the layout' -r -F`)
+	assert.Contains(t, runCompletion("completion", "powershell"), `$candidates = @('red', 'green', 'blue')`)
+}
+
+func TestCompletionHook(t *testing.T) {
+	assert.Equal(t, "bob\nbert\n", runCompletion("__complete", "paint", "owner", "b"))
+	assert.Equal(t, "", runCompletion("__complete", "paint", "color", ""))
+}
@@ -0,0 +1,79 @@
+package acrouter
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zfs123/go-ac-router/handle"
+)
+
+func freePort(t *testing.T) int {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+func TestShutdownCancelsHandlers(t *testing.T) {
+	port := freePort(t)
+	r, err := New(Address("127.0.0.1", port))
+	if err != nil {
+		t.Fatal(err)
+	}
+	entered := make(chan struct{})
+	cancelled := make(chan bool, 1)
+	r.AddApiRoute("/wait", "GET", "wait api", nil, nil, func(action handle.Action, response handle.Response) {
+		close(entered)
+		select {
+		case <-action.Context().Done():
+			cancelled <- true
+		case <-time.After(5 * time.Second):
+			cancelled <- false
+		}
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() {
+		served <- r.api.RunContext(ctx)
+	}()
+
+	url := "http://" + r.api.Server.Addr + "/wait"
+	go func() {
+		for i := 0; i < 50; i++ {
+			if resp, err := http.Get(url); err == nil {
+				resp.Body.Close()
+				return
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+	}()
+	<-entered
+	cancel()
+	assert.True(t, <-cancelled)
+	assert.NoError(t, <-served)
+}
+
+func TestInterruptCancelsCliCommand(t *testing.T) {
+	os.Args = []string{"-", "wait"}
+	r, _ := New()
+	cancelled := false
+	r.AddCliCommandByStruct("wait", "wait command", nil, func(action handle.Action, response handle.Response) {
+		_ = syscall.Kill(os.Getpid(), syscall.SIGINT)
+		select {
+		case <-action.Context().Done():
+			cancelled = true
+		case <-time.After(5 * time.Second):
+		}
+	})
+	assert.NoError(t, r.cli.Run())
+	assert.True(t, cancelled)
+}
@@ -0,0 +1,241 @@
+package acrouter
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+)
+
+// CORSConfig configures cross-origin resource sharing
+type CORSConfig struct {
+	// Allowed origins, "*" allows all but no credentials, "https://*.example.com" allows all subdomains
+	AllowOrigins []string
+	// Allowed methods, the methods registered on the path are allowed if empty
+	AllowMethods []string
+	// Allowed request headers, the headers requested by the browser are allowed if empty
+	AllowHeaders []string
+	// Response headers readable by the browser
+	ExposeHeaders []string
+	// Allow cookies and http authentication
+	AllowCredentials bool
+	// How long browsers may cache preflight responses, not sent if zero
+	MaxAge time.Duration
+}
+
+// Browsers refuse credentials for any origin, so "*" can not allow them
+func (cc *CORSConfig) validate() error {
+	if cc.allowAnyOrigin() && cc.AllowCredentials {
+		return errors.New(`cors: the "*" origin can not be combined with credentials, list the origins instead`)
+	}
+	return nil
+}
+
+func (cc *CORSConfig) allowAnyOrigin() bool {
+	for _, allowed := range cc.AllowOrigins {
+		if allowed == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// Check whether origin matches one of the allowed origins
+func (cc *CORSConfig) allowOrigin(origin string) bool {
+	for _, allowed := range cc.AllowOrigins {
+		if allowed == "*" || strings.EqualFold(allowed, origin) {
+			return true
+		}
+		if i := strings.Index(allowed, "*"); i >= 0 {
+			prefix, suffix := allowed[:i], allowed[i+1:]
+			if len(origin) > len(prefix)+len(suffix) && strings.HasPrefix(origin, prefix) && strings.HasSuffix(origin, suffix) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Set the headers shared by simple and preflight responses,
+// any origin is allowed with a literal "*" as credentials are refused then
+func (cc *CORSConfig) setOriginHeaders(c *gin.Context, origin string) {
+	if cc.allowAnyOrigin() {
+		c.Header("Access-Control-Allow-Origin", "*")
+		return
+	}
+	c.Writer.Header().Add("Vary", "Origin")
+	c.Header("Access-Control-Allow-Origin", origin)
+	if cc.AllowCredentials {
+		c.Header("Access-Control-Allow-Credentials", "true")
+	}
+}
+
+// Add cors headers to actual requests from allowed origins and answer
+// OPTIONS requests of the paths in routes, see corsPath for the exceptions
+func corsMiddleware(cc *CORSConfig, paths func(c *gin.Context) *corsPath) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Method == http.MethodOptions {
+			if p := paths(c); p != nil && p.preflight(c) {
+				corsPreflight(cc, p.methods)(c)
+				return
+			}
+		}
+		origin := c.GetHeader("Origin")
+		if origin != "" && cc.allowOrigin(origin) {
+			cc.setOriginHeaders(c, origin)
+			if len(cc.ExposeHeaders) > 0 {
+				c.Header("Access-Control-Expose-Headers", strings.Join(cc.ExposeHeaders, ", "))
+			}
+		}
+		c.Next()
+	}
+}
+
+// Answer preflight requests of a path, methods are the ones registered on it
+func corsPreflight(cc *CORSConfig, methods map[string]bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		origin := c.GetHeader("Origin")
+		requested := c.GetHeader("Access-Control-Request-Method")
+		if origin == "" || requested == "" {
+			c.Header("Allow", strings.Join(allowedMethods(cc, methods), ", "))
+			c.AbortWithStatus(http.StatusNoContent)
+			return
+		}
+		if !cc.allowOrigin(origin) {
+			abortWithError(c, http.StatusForbidden, "origin not allowed")
+			return
+		}
+		allowed := allowedMethods(cc, methods)
+		if !containsFold(allowed, requested) {
+			abortWithError(c, http.StatusForbidden, "method not allowed")
+			return
+		}
+		cc.setOriginHeaders(c, origin)
+		c.Header("Access-Control-Allow-Methods", strings.Join(allowed, ", "))
+		if len(cc.AllowHeaders) > 0 {
+			c.Header("Access-Control-Allow-Headers", strings.Join(cc.AllowHeaders, ", "))
+		} else if h := c.GetHeader("Access-Control-Request-Headers"); h != "" {
+			c.Header("Access-Control-Allow-Headers", h)
+		}
+		if cc.MaxAge > 0 {
+			c.Header("Access-Control-Max-Age", strconv.Itoa(int(cc.MaxAge.Seconds())))
+		}
+		c.AbortWithStatus(http.StatusNoContent)
+	}
+}
+
+func allowedMethods(cc *CORSConfig, methods map[string]bool) []string {
+	if len(cc.AllowMethods) > 0 {
+		return cc.AllowMethods
+	}
+	allowed := make([]string, 0, len(methods)+1)
+	for m := range methods {
+		allowed = append(allowed, m)
+	}
+	allowed = append(allowed, http.MethodOptions)
+	sort.Strings(allowed)
+	return allowed
+}
+
+func containsFold(list []string, s string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// corsPath holds the methods of a route path for preflight requests
+//
+// OPTIONS routes of the user answer all OPTIONS requests of their path,
+// Any routes only get the ones which are not preflight requests
+type corsPath struct {
+	// methods registered on the path
+	methods map[string]bool
+	// an options route of the user is registered on the path
+	userOptions bool
+	// an Any route is registered on the path
+	any bool
+}
+
+// Check whether the OPTIONS request c is answered by cors instead of a route
+func (p *corsPath) preflight(c *gin.Context) bool {
+	if p.userOptions {
+		return false
+	}
+	return !p.any || c.GetHeader("Access-Control-Request-Method") != ""
+}
+
+// Record method of path for preflight requests
+func (r *Router) addCorsPreflight(path, method string) {
+	if r.config.CORS == nil {
+		return
+	}
+	p, ok := r.corsPaths[path]
+	if !ok {
+		p = &corsPath{methods: map[string]bool{}}
+		r.corsPaths[path] = p
+	}
+	switch method {
+	case http.MethodOptions:
+		p.userOptions = true
+	case "Any":
+		p.any = true
+		for _, m := range []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch,
+			http.MethodHead, http.MethodDelete, http.MethodConnect, http.MethodTrace} {
+			p.methods[m] = true
+		}
+	default:
+		p.methods[method] = true
+	}
+}
+
+// Find the route path of the request, unmatched requests are compared with the registered paths
+func (r *Router) corsPath(c *gin.Context) *corsPath {
+	if path := c.FullPath(); path != "" {
+		return r.corsPaths[path]
+	}
+	// no OPTIONS route matched, so the methods of every path matching are allowed
+	var found *corsPath
+	for path, p := range r.corsPaths {
+		if !matchRoutePath(path, c.Request.URL.Path) {
+			continue
+		}
+		if found == nil {
+			found = &corsPath{methods: map[string]bool{}}
+		}
+		for m := range p.methods {
+			found.methods[m] = true
+		}
+	}
+	return found
+}
+
+// Check whether the request path matches the route path with :param and *wildcard segments
+func matchRoutePath(route, path string) bool {
+	routeParts := strings.Split(strings.Trim(route, "/"), "/")
+	pathParts := strings.Split(strings.Trim(path, "/"), "/")
+	for i, part := range routeParts {
+		if strings.HasPrefix(part, "*") {
+			return true
+		}
+		if i >= len(pathParts) {
+			return false
+		}
+		if strings.HasPrefix(part, ":") {
+			if pathParts[i] == "" {
+				return false
+			}
+			continue
+		}
+		if part != pathParts[i] {
+			return false
+		}
+	}
+	return len(routeParts) == len(pathParts)
+}
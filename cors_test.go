@@ -0,0 +1,106 @@
+package acrouter
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zfs123/go-ac-router/handle"
+)
+
+func TestCORS(t *testing.T) {
+	r, err := New(CORS(CORSConfig{
+		AllowOrigins:     []string{"https://*.example.com"},
+		AllowCredentials: true,
+		MaxAge:           10 * time.Minute,
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ok := func(action handle.Action, response handle.Response) {
+		response.SendSimpleOk("ok")
+	}
+	r.AddApiRoute("/items", "GET", "list items", nil, nil, ok)
+	r.AddApiRoute("/items", "POST", "create item", nil, nil, ok)
+
+	origin := header{"Origin", "https://app.example.com"}
+	w := performRequest(r, "OPTIONS", "/items", origin, header{"Access-Control-Request-Method", "POST"},
+		header{"Access-Control-Request-Headers", "Content-Type"})
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, "https://app.example.com", w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "GET, OPTIONS, POST", w.Header().Get("Access-Control-Allow-Methods"))
+	assert.Equal(t, "Content-Type", w.Header().Get("Access-Control-Allow-Headers"))
+	assert.Equal(t, "true", w.Header().Get("Access-Control-Allow-Credentials"))
+	assert.Equal(t, "600", w.Header().Get("Access-Control-Max-Age"))
+
+	w = performRequest(r, "OPTIONS", "/items", origin, header{"Access-Control-Request-Method", "DELETE"})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = performRequest(r, "OPTIONS", "/items", header{"Origin", "https://evil.com"}, header{"Access-Control-Request-Method", "GET"})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = performRequest(r, "GET", "/items", origin)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "https://app.example.com", w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, []string{"Origin", "Accept"}, w.Header()["Vary"])
+
+	w = performRequest(r, "GET", "/items", header{"Origin", "https://example.com"})
+	assert.Empty(t, w.Header().Get("Access-Control-Allow-Origin"))
+}
+
+func TestCORSAnyOrigin(t *testing.T) {
+	_, err := New(CORS(CORSConfig{AllowOrigins: []string{"*"}, AllowCredentials: true}))
+	assert.Error(t, err)
+
+	r, _ := New(CORS(CORSConfig{AllowOrigins: []string{"*"}}))
+	r.AddApiRoute("/items", "GET", "list items", nil, nil, func(action handle.Action, response handle.Response) {
+		response.SendSimpleOk("ok")
+	})
+	w := performRequest(r, "GET", "/items", header{"Origin", "https://any.com"})
+	assert.Equal(t, "*", w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Empty(t, w.Header().Get("Access-Control-Allow-Credentials"))
+}
+
+func TestCORSUserOptions(t *testing.T) {
+	r, _ := New(CORS(CORSConfig{AllowOrigins: []string{"https://app.example.com"}}))
+	ok := func(action handle.Action, response handle.Response) {
+		response.SendSimpleOk("ok")
+	}
+	options := func(action handle.Action, response handle.Response) {
+		response.SendSimpleOk("user options")
+	}
+	// the user route is added after and before the first other method of the path
+	r.AddApiRoute("/items", "GET", "list items", nil, nil, ok)
+	r.AddApiRoute("/items", "OPTIONS", "describe items", nil, nil, options)
+	r.AddApiRoute("/users/:id", "OPTIONS", "describe user", nil, nil, options)
+	r.AddApiRoute("/users/:id", "GET", "show user", nil, nil, ok)
+	r.AddApiRoute("/orders", "GET", "list orders", nil, nil, ok)
+
+	for _, path := range []string{"/items", "/users/u1"} {
+		w := performRequest(r, "OPTIONS", path, header{"Origin", "https://app.example.com"}, header{"Access-Control-Request-Method", "GET"})
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), "user options")
+		assert.NotEmpty(t, w.Header().Get("X-Request-ID"))
+	}
+	w := performRequest(r, "OPTIONS", "/orders", header{"Origin", "https://app.example.com"}, header{"Access-Control-Request-Method", "GET"})
+	assert.Equal(t, http.StatusNoContent, w.Code)
+}
+
+func TestCORSAnyRoute(t *testing.T) {
+	r, _ := New(CORS(CORSConfig{AllowOrigins: []string{"https://app.example.com"}}))
+	r.AddApiRoute("/proxy", "Any", "proxy", nil, nil, func(action handle.Action, response handle.Response) {
+		response.SendSimpleOk("proxied " + action.(*handle.ApiAction).C.Request.Method)
+	})
+
+	origin := header{"Origin", "https://app.example.com"}
+	w := performRequest(r, "OPTIONS", "/proxy", origin, header{"Access-Control-Request-Method", "PUT"})
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, "https://app.example.com", w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Contains(t, w.Header().Get("Access-Control-Allow-Methods"), "PUT")
+
+	// other OPTIONS requests reach the route
+	w = performRequest(r, "OPTIONS", "/proxy", origin)
+	assert.Contains(t, w.Body.String(), "proxied OPTIONS")
+	assert.Equal(t, "https://app.example.com", w.Header().Get("Access-Control-Allow-Origin"))
+}
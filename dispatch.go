@@ -0,0 +1,134 @@
+package acrouter
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/zfs123/go-ac-router/handle"
+	"github.com/zfs123/go-ac-router/trace"
+)
+
+// responseRecorder keeps the response of a request dispatched in process
+type responseRecorder struct {
+	header http.Header
+	code   int
+	body   bytes.Buffer
+}
+
+func newResponseRecorder() *responseRecorder {
+	return &responseRecorder{header: http.Header{}}
+}
+
+func (rr *responseRecorder) Header() http.Header {
+	return rr.header
+}
+
+func (rr *responseRecorder) WriteHeader(code int) {
+	if rr.code == 0 {
+		rr.code = code
+	}
+}
+
+func (rr *responseRecorder) Write(b []byte) (int, error) {
+	rr.WriteHeader(http.StatusOK)
+	return rr.body.Write(b)
+}
+
+// Streaming handlers flush, the recorder keeps everything anyway
+func (rr *responseRecorder) Flush() {}
+
+func (rr *responseRecorder) status() int {
+	if rr.code == 0 {
+		return http.StatusOK
+	}
+	return rr.code
+}
+
+// Fill the parameters of path from values, used values are removed
+func expandPath(path string, values url.Values) (string, error) {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if segment == "" || (segment[0] != ':' && segment[0] != '*') {
+			continue
+		}
+		name := segment[1:]
+		value := values.Get(name)
+		if value == "" {
+			return "", errors.Errorf("missing path parameter %s", name)
+		}
+		values.Del(name)
+		if segment[0] == '*' {
+			segments[i] = strings.TrimPrefix(value, "/")
+		} else {
+			segments[i] = url.PathEscape(value)
+		}
+	}
+	return strings.Join(segments, "/"), nil
+}
+
+// Build a request for route, the parameters of its path are taken from values
+func (r *Router) newRouteRequest(ctx context.Context, route *Route, values url.Values, parent *http.Request) (*http.Request, error) {
+	path, err := expandPath(route.Path, values)
+	if err != nil {
+		return nil, err
+	}
+	method := route.Method
+	if method == "Any" {
+		method = http.MethodPost
+	}
+	return r.newSubRequest(ctx, method, path, values, parent)
+}
+
+// Build a request dispatched in process, values go to the query of reads and to a form body otherwise
+//
+// Headers and the remote address are taken from parent if set, so credentials
+// and client based rate limits apply as if the route was called directly
+func (r *Router) newSubRequest(ctx context.Context, method, target string, values url.Values, parent *http.Request) (*http.Request, error) {
+	u, err := url.Parse(target)
+	if err != nil || !strings.HasPrefix(u.Path, "/") {
+		return nil, errors.Errorf("invalid path %s", target)
+	}
+	body := ""
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodDelete:
+		query := u.Query()
+		for k, v := range values {
+			query[k] = append(query[k], v...)
+		}
+		u.RawQuery = query.Encode()
+	default:
+		body = values.Encode()
+	}
+	req, err := http.NewRequest(method, u.String(), strings.NewReader(body))
+	if err != nil {
+		return nil, errors.Wrap(err, "build request")
+	}
+	req = req.WithContext(ctx)
+	if parent != nil {
+		for k, v := range parent.Header {
+			req.Header[k] = v
+		}
+		req.RemoteAddr = parent.RemoteAddr
+		req.Header.Del("Content-Length")
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if id := handle.RequestIDFromContext(ctx); id != "" && validRequestID(id) && r.config.RequestIDHeader != "" {
+		req.Header.Set(r.config.RequestIDHeader, id)
+	}
+	if span := trace.SpanFromContext(ctx); span != nil {
+		req.Header.Set(trace.TraceparentHeader, span.SpanContext().Traceparent())
+	}
+	return req, nil
+}
+
+// Serve a request through the engine without a connection
+func (r *Router) dispatch(req *http.Request) *responseRecorder {
+	rr := newResponseRecorder()
+	r.api.Engine.ServeHTTP(rr, req)
+	return rr
+}
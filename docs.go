@@ -0,0 +1,509 @@
+package acrouter
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/urfave/cli/v2"
+)
+
+// DocFile is a generated documentation file
+type DocFile struct {
+	Name    string
+	Content string
+}
+
+// appDoc describes the app for the doc renderers
+type appDoc struct {
+	Program     string
+	Usage       string
+	Description string
+	Version     string
+	Flags       []docFlag
+	Commands    []commandDoc
+}
+
+// commandDoc describes a command and the route behind it
+type commandDoc struct {
+	Name        string
+	Aliases     []string
+	Usage       string
+	Description string
+	ArgsUsage   string
+	Method      string
+	Path        string
+	RPCMethod   string
+	Async       bool
+	WebSocket   bool
+	Mutating    bool
+	Destructive bool
+	Flags       []docFlag
+	Subcommands []commandDoc
+}
+
+// docFlag describes a flag of a command
+type docFlag struct {
+	Names      []string
+	Usage      string
+	TakesValue bool
+	Required   bool
+	Default    string
+	Values     []string
+	File       bool
+}
+
+// Render roff man pages, one per command and one for the app, or a single combined page
+func (r *Router) ManPages(combined bool) []DocFile {
+	doc := r.appDoc()
+	files := []DocFile{{Name: doc.Program + ".1", Content: manAppPage(doc, combined)}}
+	if combined {
+		return files
+	}
+	for _, command := range doc.Commands {
+		files = append(files, DocFile{Name: doc.Program + "-" + command.Name + ".1", Content: manCommandPage(doc, command)})
+	}
+	return files
+}
+
+// Render markdown reference files, one per command and one for the app, or a single combined file
+func (r *Router) MarkdownPages(combined bool) []DocFile {
+	doc := r.appDoc()
+	files := []DocFile{{Name: doc.Program + ".md", Content: markdownAppPage(doc, combined)}}
+	if combined {
+		return files
+	}
+	for _, command := range doc.Commands {
+		var b strings.Builder
+		markdownCommand(&b, doc, command, 1, true)
+		files = append(files, DocFile{Name: doc.Program + "-" + command.Name + ".md", Content: b.String()})
+	}
+	return files
+}
+
+// Command writing the man pages or markdown reference of the app
+func (r *Router) docCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "doc",
+		Usage: "generate man pages or a markdown reference of all commands",
+		Flags: []cli.Flag{
+			&cli.StringFlag{Name: "format", Usage: "man or markdown", Value: "man"},
+			&cli.StringFlag{Name: "out-dir", Usage: "directory the files are written to, a combined page is printed if empty", TakesFile: true},
+			&cli.BoolFlag{Name: "combined", Usage: "write a single page covering every command"},
+		},
+		Action: func(c *cli.Context) error {
+			outDir := c.String("out-dir")
+			combined := c.Bool("combined") || outDir == ""
+			var files []DocFile
+			switch c.String("format") {
+			case "man":
+				files = r.ManPages(combined)
+			case "markdown", "md":
+				files = r.MarkdownPages(combined)
+			default:
+				return cli.Exit("format must be man or markdown", 1)
+			}
+			if outDir == "" {
+				_, _ = fmt.Fprint(c.App.Writer, files[0].Content)
+				return nil
+			}
+			if err := os.MkdirAll(outDir, 0755); err != nil {
+				return errors.Wrap(err, "create output directory")
+			}
+			for _, file := range files {
+				path := filepath.Join(outDir, file.Name)
+				if err := ioutil.WriteFile(path, []byte(file.Content), 0644); err != nil {
+					return errors.Wrapf(err, "write %s", path)
+				}
+				_, _ = fmt.Fprintln(c.App.Writer, path)
+			}
+			return nil
+		},
+	}
+}
+
+// Collect the visible commands of the app with their flags and routes
+func (r *Router) appDoc() appDoc {
+	r.cli.addBuiltinCommands()
+	app := r.cli.App
+	// cli sets the defaults of the app when it runs
+	app.Setup()
+	doc := appDoc{
+		Program:     app.Name,
+		Usage:       app.Usage,
+		Description: app.Description,
+		Version:     app.Version,
+		Flags:       docFlags(app.VisibleFlags(), nil),
+	}
+	for _, command := range app.VisibleCommands() {
+		if command.Name == "help" {
+			continue
+		}
+		doc.Commands = append(doc.Commands, r.commandDoc(command))
+	}
+	return doc
+}
+
+func (r *Router) commandDoc(command *cli.Command) commandDoc {
+	cd := commandDoc{
+		Name:        command.Name,
+		Usage:       command.Usage,
+		Description: command.Description,
+		ArgsUsage:   command.ArgsUsage,
+	}
+	for _, alias := range command.Aliases {
+		if alias != command.Name {
+			cd.Aliases = append(cd.Aliases, alias)
+		}
+	}
+	route := r.commandRoutes[command.Name]
+	if route != nil {
+		cd.Method, cd.Path, cd.Async = route.Method, route.Path, route.Async
+		cd.Mutating, cd.Destructive = route.Mutating, route.Destructive
+		cd.WebSocket = route.WebSocketFunc != nil
+		if r.config.JSONRPCPath != "" {
+			cd.RPCMethod = route.RPCMethod
+		}
+	}
+	cd.Flags = docFlags(command.Flags, route)
+	for _, sub := range command.Subcommands {
+		if !sub.Hidden {
+			cd.Subcommands = append(cd.Subcommands, r.commandDoc(sub))
+		}
+	}
+	return cd
+}
+
+func docFlags(flags []cli.Flag, route *Route) []docFlag {
+	var docs []docFlag
+	for _, flag := range flags {
+		if flag == cli.HelpFlag {
+			continue
+		}
+		described := describeFlag(flag, route)
+		df := docFlag{
+			Names:      flag.Names(),
+			Usage:      described.Usage,
+			TakesValue: described.TakesValue,
+			Values:     described.Values,
+			File:       described.File,
+		}
+		if required, ok := flag.(cli.RequiredFlag); ok {
+			df.Required = required.IsRequired()
+		}
+		if doc, ok := flag.(cli.DocGenerationFlag); ok && df.TakesValue {
+			df.Default = doc.GetValue()
+		}
+		docs = append(docs, df)
+	}
+	return docs
+}
+
+// Flag names as typed on the command line
+func (df docFlag) spellings() []string {
+	spellings := make([]string, len(df.Names))
+	for i, name := range df.Names {
+		if len(name) == 1 {
+			spellings[i] = "-" + name
+		} else {
+			spellings[i] = "--" + name
+		}
+	}
+	return spellings
+}
+
+func (df docFlag) placeholder() string {
+	if df.File {
+		return "file"
+	}
+	return "value"
+}
+
+// Sentences on requirement, allowed values and default of the flag
+func (df docFlag) details() []string {
+	var details []string
+	if df.Required {
+		details = append(details, "Required.")
+	}
+	if len(df.Values) > 0 {
+		details = append(details, "One of: "+strings.Join(df.Values, ", ")+".")
+	}
+	if df.Default != "" && df.Default != `""` {
+		details = append(details, "Default: "+df.Default+".")
+	}
+	return details
+}
+
+// Usage of the flag followed by its details
+func (df docFlag) text() string {
+	details := df.details()
+	if len(details) == 0 {
+		return df.Usage
+	}
+	usage := df.Usage
+	if usage != "" && !strings.HasSuffix(usage, ".") {
+		usage += "."
+	}
+	return strings.TrimSpace(usage + " " + strings.Join(details, " "))
+}
+
+// Sentences on the http route behind the command
+func (cd commandDoc) routeDetails() []string {
+	if cd.Path == "" {
+		return nil
+	}
+	var details []string
+	if cd.WebSocket {
+		details = append(details, "Connects to the websocket route "+cd.Path+", stdin lines are sent as messages.")
+	}
+	if cd.Async {
+		details = append(details, "Runs as a background job with --async or --wait.")
+	}
+	switch {
+	case cd.Destructive:
+		details = append(details, "Destroys data, asks for confirmation on a terminal and requires --yes otherwise; --dry-run or the dry_run parameter only reports the changes.")
+	case cd.Mutating:
+		details = append(details, "Changes state; --dry-run or the dry_run parameter only reports the changes.")
+	}
+	if cd.RPCMethod != "" {
+		details = append(details, "Callable as json-rpc method "+cd.RPCMethod+".")
+	}
+	return details
+}
+
+func (cd commandDoc) synopsis(program string) string {
+	s := program + " " + cd.Name
+	if len(cd.Subcommands) > 0 {
+		s += " command"
+	}
+	if len(cd.Flags) > 0 {
+		s += " [options]"
+	}
+	if cd.ArgsUsage != "" {
+		s += " " + cd.ArgsUsage
+	}
+	return s
+}
+
+// Escape text for roff, dashes are kept as dashes and control lines are defused
+func roff(s string) string {
+	s = strings.NewReplacer(`\`, `\e`, "-", `\-`).Replace(s)
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		if strings.HasPrefix(line, ".") || strings.HasPrefix(line, "'") {
+			lines[i] = `\&` + line
+		}
+	}
+	return strings.Join(lines, "\n.br\n")
+}
+
+func manHeader(b *strings.Builder, title string, doc appDoc) {
+	source := doc.Program
+	if doc.Version != "" {
+		source += " " + doc.Version
+	}
+	fmt.Fprintf(b, ".TH \"%s\" \"1\" \"\" \"%s\" \"User Commands\"\n", roff(strings.ToUpper(title)), roff(source))
+}
+
+func manFlags(b *strings.Builder, flags []docFlag) {
+	for _, flag := range flags {
+		b.WriteString(".TP\n")
+		names := make([]string, len(flag.Names))
+		for i, spelling := range flag.spellings() {
+			names[i] = `\fB` + roff(spelling) + `\fR`
+		}
+		b.WriteString(strings.Join(names, ", "))
+		if flag.TakesValue {
+			b.WriteString(` \fI` + flag.placeholder() + `\fR`)
+		}
+		b.WriteString("\n")
+		b.WriteString(roff(flag.text()) + "\n")
+	}
+}
+
+// Write the description, route and options of a command, under .SS headings if nested
+func manCommandBody(b *strings.Builder, doc appDoc, command commandDoc, nested bool) {
+	section := func(name string) {
+		if nested {
+			fmt.Fprintf(b, ".PP\n\\fI%s\\fR\n", name)
+		} else {
+			fmt.Fprintf(b, ".SH %s\n", name)
+		}
+	}
+	if !nested {
+		section("DESCRIPTION")
+	}
+	if command.Usage != "" {
+		b.WriteString(roff(command.Usage) + "\n")
+	}
+	if command.Description != "" {
+		b.WriteString(".PP\n" + roff(command.Description) + "\n")
+	}
+	if len(command.Aliases) > 0 {
+		b.WriteString(".PP\nAliases: " + roff(strings.Join(command.Aliases, ", ")) + "\n")
+	}
+	if command.Path != "" {
+		section("HTTP")
+		fmt.Fprintf(b, "\\fB%s %s\\fR\n", command.Method, roff(command.Path))
+		for _, detail := range command.routeDetails() {
+			b.WriteString(".br\n" + roff(detail) + "\n")
+		}
+	}
+	if len(command.Flags) > 0 {
+		section("OPTIONS")
+		manFlags(b, command.Flags)
+	}
+	if len(command.Subcommands) > 0 {
+		section("COMMANDS")
+		for _, sub := range command.Subcommands {
+			fmt.Fprintf(b, ".TP\n\\fB%s\\fR\n%s\n", roff(sub.synopsis(doc.Program+" "+command.Name)), roff(sub.Usage))
+		}
+	}
+}
+
+func manAppPage(doc appDoc, combined bool) string {
+	var b strings.Builder
+	manHeader(&b, doc.Program, doc)
+	fmt.Fprintf(&b, ".SH NAME\n%s \\- %s\n", roff(doc.Program), roff(doc.Usage))
+	fmt.Fprintf(&b, ".SH SYNOPSIS\n.B %s\n[\\fIglobal options\\fR] \\fIcommand\\fR [\\fIcommand options\\fR] [\\fIarguments...\\fR]\n", roff(doc.Program))
+	if doc.Description != "" {
+		b.WriteString(".SH DESCRIPTION\n" + roff(doc.Description) + "\n")
+	}
+	if len(doc.Flags) > 0 {
+		b.WriteString(".SH GLOBAL OPTIONS\n")
+		manFlags(&b, doc.Flags)
+	}
+	b.WriteString(".SH COMMANDS\n")
+	for _, command := range doc.Commands {
+		if combined {
+			fmt.Fprintf(&b, ".SS \"%s\"\n", roff(command.synopsis(doc.Program)))
+			manCommandBody(&b, doc, command, true)
+			continue
+		}
+		fmt.Fprintf(&b, ".TP\n\\fB%s\\fR\n%s\n", roff(command.Name), roff(command.Usage))
+	}
+	if !combined && len(doc.Commands) > 0 {
+		b.WriteString(".SH SEE ALSO\n")
+		refs := make([]string, len(doc.Commands))
+		for i, command := range doc.Commands {
+			refs[i] = `\fB` + roff(doc.Program+"-"+command.Name) + `\fR(1)`
+		}
+		b.WriteString(strings.Join(refs, ",\n") + "\n")
+	}
+	return b.String()
+}
+
+func manCommandPage(doc appDoc, command commandDoc) string {
+	var b strings.Builder
+	manHeader(&b, doc.Program+"-"+command.Name, doc)
+	fmt.Fprintf(&b, ".SH NAME\n%s \\- %s\n", roff(doc.Program+"-"+command.Name), roff(command.Usage))
+	fmt.Fprintf(&b, ".SH SYNOPSIS\n.B %s\n", roff(command.synopsis(doc.Program)))
+	manCommandBody(&b, doc, command, false)
+	fmt.Fprintf(&b, ".SH SEE ALSO\n\\fB%s\\fR(1)\n", roff(doc.Program))
+	return b.String()
+}
+
+// Escape text for a markdown table cell
+func markdownCell(s string) string {
+	return strings.NewReplacer("|", `\|`, "\n", "<br>").Replace(s)
+}
+
+func markdownFlags(b *strings.Builder, flags []docFlag) {
+	b.WriteString("| Flag | Description |\n| --- | --- |\n")
+	for _, flag := range flags {
+		names := make([]string, len(flag.Names))
+		for i, spelling := range flag.spellings() {
+			if flag.TakesValue {
+				spelling += " " + flag.placeholder()
+			}
+			names[i] = "`" + spelling + "`"
+		}
+		fmt.Fprintf(b, "| %s | %s |\n", strings.Join(names, ", "), markdownCell(flag.text()))
+	}
+}
+
+// Write the reference of a command with its title at heading level
+func markdownCommand(b *strings.Builder, doc appDoc, command commandDoc, level int, standalone bool) {
+	heading := strings.Repeat("#", level)
+	fmt.Fprintf(b, "%s %s %s\n\n", heading, doc.Program, command.Name)
+	if command.Usage != "" {
+		b.WriteString(command.Usage + "\n\n")
+	}
+	fmt.Fprintf(b, "```\n%s\n```\n\n", command.synopsis(doc.Program))
+	if command.Description != "" {
+		b.WriteString(command.Description + "\n\n")
+	}
+	if len(command.Aliases) > 0 {
+		b.WriteString("Aliases: `" + strings.Join(command.Aliases, "`, `") + "`\n\n")
+	}
+	if command.Path != "" {
+		fmt.Fprintf(b, "%s# HTTP\n\n`%s %s`\n\n", heading, command.Method, command.Path)
+		if details := command.routeDetails(); len(details) > 0 {
+			b.WriteString(strings.Join(details, " ") + "\n\n")
+		}
+	}
+	if len(command.Flags) > 0 {
+		fmt.Fprintf(b, "%s# Options\n\n", heading)
+		markdownFlags(b, command.Flags)
+		b.WriteString("\n")
+	}
+	if len(command.Subcommands) > 0 {
+		fmt.Fprintf(b, "%s# Commands\n\n", heading)
+		for _, sub := range command.Subcommands {
+			fmt.Fprintf(b, "- `%s`: %s\n", sub.synopsis(doc.Program+" "+command.Name), sub.Usage)
+		}
+		b.WriteString("\n")
+	}
+	if standalone {
+		fmt.Fprintf(b, "See also [%s](%s.md).\n", doc.Program, doc.Program)
+	}
+}
+
+func markdownAppPage(doc appDoc, combined bool) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s\n\n", doc.Program)
+	if doc.Usage != "" {
+		b.WriteString(doc.Usage + "\n\n")
+	}
+	fmt.Fprintf(&b, "```\n%s [global options] command [command options] [arguments...]\n```\n\n", doc.Program)
+	if doc.Description != "" {
+		b.WriteString(doc.Description + "\n\n")
+	}
+	if len(doc.Flags) > 0 {
+		b.WriteString("## Global options\n\n")
+		markdownFlags(&b, doc.Flags)
+		b.WriteString("\n")
+	}
+	b.WriteString("## Commands\n\n")
+	for _, command := range doc.Commands {
+		link := doc.Program + "-" + command.Name + ".md"
+		if combined {
+			link = "#" + markdownAnchor(doc.Program+" "+command.Name)
+		}
+		fmt.Fprintf(&b, "- [`%s`](%s): %s\n", command.Name, link, command.Usage)
+	}
+	if combined {
+		b.WriteString("\n")
+		for _, command := range doc.Commands {
+			markdownCommand(&b, doc, command, 3, false)
+		}
+	}
+	return strings.TrimRight(b.String(), "\n") + "\n"
+}
+
+// Anchor github generates for a heading
+func markdownAnchor(heading string) string {
+	var b strings.Builder
+	for _, ch := range strings.ToLower(heading) {
+		switch {
+		case ch == ' ':
+			b.WriteRune('-')
+		case ch == '-' || ch == '_' || (ch >= 'a' && ch <= 'z') || (ch >= '0' && ch <= '9'):
+			b.WriteRune(ch)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,69 @@
+package acrouter
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zfs123/go-ac-router/handle"
+)
+
+func newDocsRouter() *Router {
+	r, _ := New(JSONRPC(""))
+	r.cli.App.Name = "app"
+	r.AddMultiRoute("/paint", "POST", "paint a wall", &paintParams{}, nil, func(handle.Action, handle.Response) {},
+		Permissions("walls:paint"))
+	return r
+}
+
+func TestManPages(t *testing.T) {
+	files := newDocsRouter().ManPages(false)
+	assert.Equal(t, "app.1", files[0].Name)
+	assert.Contains(t, files[0].Content, `\fBapp\-paint\fR(1)`)
+
+	var page string
+	for _, file := range files {
+		if file.Name == "app-paint.1" {
+			page = file.Content
+		}
+	}
+	assert.Contains(t, page, ".TH \"APP\\-PAINT\" \"1\"")
+	assert.Contains(t, page, ".SH HTTP\n\\fBPOST /paint\\fR\n.br\nCallable as json\\-rpc method paint.\n")
+	assert.Contains(t, page, ".TP\n\\fB\\-\\-color\\fR \\fIvalue\\fR\ncolor to paint. Required. One of: red, green, blue.\n")
+	assert.Contains(t, page, "Requires permissions: walls:paint")
+
+	combined := newDocsRouter().ManPages(true)
+	assert.Len(t, combined, 1)
+	assert.Contains(t, combined[0].Content, ".SS \"app paint [options]\"")
+}
+
+func TestMarkdownPages(t *testing.T) {
+	files := newDocsRouter().MarkdownPages(true)
+	assert.Len(t, files, 1)
+	assert.Contains(t, files[0].Content, "- [`paint`](#app-paint): paint a wall\n")
+	assert.Contains(t, files[0].Content, "### app paint\n")
+	assert.Contains(t, files[0].Content, "| `--input file` | file with the layout |\n")
+}
+
+func TestDocCommand(t *testing.T) {
+	dir, err := ioutil.TempDir("", "docs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	os.Args = []string{"app", "doc", "--format", "markdown", "--out-dir", dir}
+	r := newDocsRouter()
+	out := &bytes.Buffer{}
+	r.cli.App.Writer = out
+	r.Run()
+
+	assert.Contains(t, out.String(), filepath.Join(dir, "app-paint.md")+"\n")
+	b, err := ioutil.ReadFile(filepath.Join(dir, "app-paint.md"))
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(b), "# app paint\n"))
+}
@@ -0,0 +1,33 @@
+package acrouter
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/zfs123/go-ac-router/handle"
+	"github.com/zfs123/go-ac-router/utils"
+)
+
+// Select response formats by the query parameter name, formats are only negotiated by Accept if name is empty
+//
+// Routes binding a parameter of that name keep it and negotiate by Accept
+func FormatParam(name string) Option {
+	return func(s *RouterConfig) {
+		s.FormatParam = name
+	}
+}
+
+// Set the query parameter selecting response formats for the rest of the chain
+func formatParamMiddleware(name string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Request = c.Request.WithContext(handle.ContextWithFormatParam(c.Request.Context(), name))
+		c.Next()
+	}
+}
+
+// Check whether the params of route bind the format parameter themselves
+func (r *Router) bindsFormatParam(route *Route) bool {
+	if r.config.FormatParam == "" || route.Params == nil {
+		return false
+	}
+	_, ok := utils.FindField(route.Params, r.config.FormatParam)
+	return ok
+}
@@ -0,0 +1,115 @@
+package acrouter
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zfs123/go-ac-router/handle"
+)
+
+type reportRow struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+func negotiate(r *Router, target, accept string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("GET", target, nil)
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	w := httptest.NewRecorder()
+	r.api.Engine.ServeHTTP(w, req)
+	return w
+}
+
+func TestContentNegotiation(t *testing.T) {
+	r, _ := New()
+	r.AddApiRoute("/report", "GET", "report", nil, nil, func(action handle.Action, response handle.Response) {
+		response.Response(http.StatusOK, []reportRow{{"a", 1}, {"b,c", 2}})
+	})
+	r.AddApiRoute("/name", "GET", "name", nil, nil, func(action handle.Action, response handle.Response) {
+		response.Response(http.StatusOK, "bob")
+	})
+
+	w := negotiate(r, "/report", "")
+	assert.Equal(t, "application/json; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Equal(t, `[{"name":"a","count":1},{"name":"b,c","count":2}]`, w.Body.String())
+
+	w = negotiate(r, "/report", "text/csv;q=0.9, application/xml;q=0.5")
+	assert.Equal(t, "text/csv; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Equal(t, "name,count\na,1\n\"b,c\",2\n", w.Body.String())
+
+	w = negotiate(r, "/report?format=yaml", "application/json")
+	assert.Equal(t, "- count: 1\n  name: a\n- count: 2\n  name: b,c\n", w.Body.String())
+
+	w = negotiate(r, "/report", "application/xml")
+	assert.Equal(t, `<?xml version="1.0" encoding="UTF-8"?>`+"\n"+
+		`<response><item><count>1</count><name>a</name></item><item><count>2</count><name>b,c</name></item></response>`, w.Body.String())
+
+	w = negotiate(r, "/report", "application/msgpack")
+	assert.Equal(t, "application/msgpack", w.Header().Get("Content-Type"))
+	assert.Equal(t, byte(0x92), w.Body.Bytes()[0])
+
+	// csv can not represent a string, text is the next accepted format
+	w = negotiate(r, "/name", "text/csv, text/*;q=0.5")
+	assert.Equal(t, "text/plain; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Equal(t, "bob", w.Body.String())
+
+	assert.Equal(t, http.StatusNotAcceptable, negotiate(r, "/report", "text/plain").Code)
+	assert.Equal(t, http.StatusNotAcceptable, negotiate(r, "/report", "image/png").Code)
+	assert.Equal(t, http.StatusNotAcceptable, negotiate(r, "/report?format=toml", "").Code)
+	assert.Equal(t, http.StatusOK, negotiate(r, "/report", "text/event-stream").Code)
+}
+
+func TestRegisterEncoder(t *testing.T) {
+	handle.RegisterEncoder("upper", func(w io.Writer, data interface{}) error {
+		s, ok := data.(string)
+		if !ok {
+			return handle.ErrNotEncodable
+		}
+		_, err := io.WriteString(w, "NAME="+s)
+		return err
+	}, "application/vnd.upper")
+	r, _ := New()
+	r.AddApiRoute("/name", "GET", "name", nil, nil, func(action handle.Action, response handle.Response) {
+		response.Response(http.StatusOK, "bob")
+	})
+
+	w := negotiate(r, "/name", "application/vnd.upper")
+	assert.Equal(t, "application/vnd.upper", w.Header().Get("Content-Type"))
+	assert.Equal(t, "NAME=bob", w.Body.String())
+	assert.Equal(t, "NAME=bob", negotiate(r, "/name?format=upper", "").Body.String())
+	assert.Contains(t, handle.Formats(), "upper")
+}
+
+type exportParams struct {
+	Format string `form:"format"`
+}
+
+func TestFormatParam(t *testing.T) {
+	r, _ := New()
+	r.AddApiRoute("/export", "GET", "export", &exportParams{}, nil, func(action handle.Action, response handle.Response) {
+		response.Response(http.StatusOK, []reportRow{{action.String("format"), 1}})
+	})
+
+	// the route binds format itself, so it does not select the response format
+	w := negotiate(r, "/export?format=csv", "")
+	assert.Equal(t, "application/json; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Equal(t, `[{"name":"csv","count":1}]`, w.Body.String())
+
+	r, _ = New(FormatParam("as"))
+	r.AddApiRoute("/report", "GET", "report", nil, nil, func(action handle.Action, response handle.Response) {
+		response.Response(http.StatusOK, []reportRow{{"a", 1}})
+	})
+	assert.Equal(t, "name,count\na,1\n", negotiate(r, "/report?as=csv", "").Body.String())
+	assert.Equal(t, `[{"name":"a","count":1}]`, negotiate(r, "/report?format=csv", "").Body.String())
+
+	r, _ = New(FormatParam(""))
+	r.AddApiRoute("/report", "GET", "report", nil, nil, func(action handle.Action, response handle.Response) {
+		response.Response(http.StatusOK, []reportRow{{"a", 1}})
+	})
+	assert.Equal(t, `[{"name":"a","count":1}]`, negotiate(r, "/report?format=csv", "").Body.String())
+}
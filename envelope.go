@@ -0,0 +1,14 @@
+package acrouter
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/zfs123/go-ac-router/handle"
+)
+
+// Wrap the output of the request in envelopes shaped by shape
+func envelopeMiddleware(shape handle.EnvelopeFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Request = c.Request.WithContext(handle.ContextWithEnvelope(c.Request.Context(), shape))
+		c.Next()
+	}
+}
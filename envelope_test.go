@@ -0,0 +1,115 @@
+package acrouter
+
+import (
+	"bytes"
+	"net/http"
+	"os"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zfs123/go-ac-router/handle"
+)
+
+type listParams struct {
+	Limit  int    `form:"limit"`
+	Cursor string `form:"cursor"`
+}
+
+// List the numbers 0 to 4, the cursor is the first number of a page
+func listHandler(action handle.Action, response handle.Response) {
+	page, err := handle.Paginate(action, 2, 3)
+	if err != nil {
+		response.Response(http.StatusBadRequest, err.Error())
+		return
+	}
+	start, _ := strconv.Atoi(page.Cursor)
+	var items []int
+	for i := start; i < 5 && len(items) < page.Limit; i++ {
+		items = append(items, i)
+	}
+	if next := start + len(items); next < 5 {
+		page.SetNext(strconv.Itoa(next))
+	}
+	page.SetTotal(5)
+	response.SetPage(page)
+	if page.Limit == 3 {
+		response.Warn("limit capped at 3")
+	}
+	response.Response(http.StatusOK, items)
+}
+
+func TestEnvelopeApi(t *testing.T) {
+	r, _ := New(ResponseEnvelope(nil))
+	r.AddApiRoute("/numbers", "GET", "numbers", &listParams{}, nil, listHandler)
+	r.AddApiRoute("/fail", "GET", "fail", nil, nil, func(action handle.Action, response handle.Response) {
+		response.SendSimpleFail("broken")
+	})
+
+	w := performRequest(r, "GET", "/numbers?cursor=2", header{"X-Request-ID", "req-1"})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"data":[2,3],"meta":{"request_id":"req-1",
+		"pagination":{"limit":2,"cursor":"2","next_cursor":"4","total":5}}}`, w.Body.String())
+	assert.Equal(t, `</numbers?cursor=4&limit=2>; rel="next", </numbers?limit=2>; rel="first"`, w.Header().Get("Link"))
+
+	w = performRequest(r, "GET", "/numbers?limit=10&cursor=3", header{"X-Request-ID", "req-2"})
+	assert.JSONEq(t, `{"data":[3,4],"meta":{"request_id":"req-2",
+		"pagination":{"limit":3,"cursor":"3","total":5},"warnings":["limit capped at 3"]}}`, w.Body.String())
+	assert.Equal(t, `</numbers?limit=3>; rel="first"`, w.Header().Get("Link"))
+	assert.Empty(t, w.Header().Get("Warning"))
+
+	w = performRequest(r, "GET", "/numbers?limit=x", header{"X-Request-ID", "req-3"})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.JSONEq(t, `{"data":null,"error":{"status":400,"message":"limit must be a positive number"},"meta":{"request_id":"req-3"}}`, w.Body.String())
+
+	w = performRequest(r, "GET", "/fail", header{"X-Request-ID", "req-4"})
+	assert.JSONEq(t, `{"data":null,"error":{"status":500,"message":"broken"},"meta":{"request_id":"req-4"}}`, w.Body.String())
+
+	w = performRequest(r, "GET", "/missing", header{"X-Request-ID", "req-5"})
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.JSONEq(t, `{"data":null,"error":{"status":404,"message":"Page not found"},"meta":{"request_id":"req-5"}}`, w.Body.String())
+}
+
+func TestWarningHeader(t *testing.T) {
+	r, _ := New()
+	r.AddApiRoute("/numbers", "GET", "numbers", &listParams{}, nil, listHandler)
+
+	w := performRequest(r, "GET", "/numbers?limit=10")
+	assert.Equal(t, "[0,1,2]", w.Body.String())
+	assert.Equal(t, `299 - "limit capped at 3"`, w.Header().Get("Warning"))
+	assert.Empty(t, performRequest(r, "GET", "/numbers").Header().Get("Warning"))
+}
+
+func TestEnvelopeShape(t *testing.T) {
+	r, _ := New(ResponseEnvelope(func(e *handle.Envelope) interface{} {
+		if e.Error != nil {
+			return map[string]interface{}{"ok": false, "reason": e.Error.Message}
+		}
+		return map[string]interface{}{"ok": true, "result": e.Data}
+	}))
+	r.AddApiRoute("/hello", "GET", "hello", nil, nil, func(action handle.Action, response handle.Response) {
+		response.SendSimpleOk("hi")
+	})
+	assert.JSONEq(t, `{"ok":true,"result":{"message":"hi"}}`, performRequest(r, "GET", "/hello").Body.String())
+	assert.JSONEq(t, `{"ok":false,"reason":"Page not found"}`, performRequest(r, "GET", "/nothing").Body.String())
+}
+
+func TestPaginationCli(t *testing.T) {
+	for _, c := range []struct {
+		opts      []Option
+		out, warn string
+	}{
+		{nil, "code 200,msg [0,1,2]\n", "warning: limit capped at 3\nmore results with --cursor 3\n"},
+		{[]Option{ResponseEnvelope(nil)}, `{"data":[0,1,2],"meta":{"request_id":"`, ""},
+	} {
+		os.Args = []string{"-", "numbers", "--limit", "5"}
+		r, _ := New(c.opts...)
+		out, errOut := &bytes.Buffer{}, &bytes.Buffer{}
+		r.cli.App.Writer = out
+		r.cli.App.ErrWriter = errOut
+		r.AddMultiRoute("/numbers", "GET", "numbers", &listParams{}, nil, listHandler)
+		r.Run()
+		assert.Contains(t, out.String(), c.out)
+		assert.Equal(t, c.warn, errOut.String())
+	}
+}
@@ -0,0 +1,19 @@
+package acrouter
+
+import (
+	"github.com/urfave/cli/v2"
+)
+
+// Declare the route as sending files, its cli command gets an --out flag
+func Downloads() RouteOption {
+	return func(route *Route) {
+		route.Downloads = true
+	}
+}
+
+// Flags added to the cli commands of routes sending files
+func downloadFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{Name: "out", Aliases: []string{"o"}, Usage: "file or directory the download is written to, stdout if empty or -", TakesFile: true},
+	}
+}
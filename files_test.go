@@ -0,0 +1,126 @@
+package acrouter
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/zfs123/go-ac-router/handle"
+)
+
+type uploadParams struct {
+	Title string       `form:"title"`
+	Doc   *handle.File `form:"doc" binding:"required" description:"document to store"`
+}
+
+func uploadHandler(action handle.Action, response handle.Response) {
+	var params uploadParams
+	if err := action.ShouldBind(&params); err != nil {
+		response.Response(http.StatusBadRequest, gin.H{"msg": err.Error()})
+		return
+	}
+	f, err := params.Doc.Open()
+	if err != nil {
+		response.SendSimpleFail(err.Error())
+		return
+	}
+	defer f.Close()
+	content, _ := ioutil.ReadAll(f)
+	response.Response(http.StatusOK, gin.H{"title": params.Title, "name": params.Doc.Name, "size": params.Doc.Size, "content": string(content)})
+}
+
+func downloadHandler(action handle.Action, response handle.Response) {
+	var content io.Reader = strings.NewReader("id,name\n1,bob\n")
+	if action.Bool("stream") {
+		content = io.MultiReader(content)
+	}
+	_ = response.SendFile(handle.Download{Name: "users.csv", Content: content})
+}
+
+func TestUploadApi(t *testing.T) {
+	r, _ := New()
+	r.AddApiRoute("/upload", "POST", "upload", &uploadParams{}, nil, uploadHandler)
+
+	body := &bytes.Buffer{}
+	mw := multipart.NewWriter(body)
+	_ = mw.WriteField("title", "notes")
+	fw, _ := mw.CreateFormFile("doc", "notes.txt")
+	_, _ = fw.Write([]byte("hello"))
+	_ = mw.Close()
+	req := httptest.NewRequest("POST", "/upload", body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	w := httptest.NewRecorder()
+	r.api.Engine.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"title":"notes","name":"notes.txt","size":5,"content":"hello"}`, w.Body.String())
+
+	assert.Equal(t, http.StatusBadRequest, performRequest(r, "POST", "/upload?title=notes").Code)
+}
+
+func TestUploadCli(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "upload")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "notes.txt")
+	_ = ioutil.WriteFile(path, []byte("from file"), 0644)
+
+	for _, c := range []struct{ arg, want string }{
+		{path, `{"content":"from file","name":"notes.txt","size":9,"title":"t"}`},
+		{"-", `{"content":"from stdin","name":"stdin","size":-1,"title":"t"}`},
+	} {
+		os.Args = []string{"-", "upload", "--title", "t", "--doc", c.arg}
+		r, _ := New()
+		out := &bytes.Buffer{}
+		r.cli.App.Writer = out
+		r.cli.App.Reader = strings.NewReader("from stdin")
+		r.AddMultiRoute("/upload", "POST", "upload", &uploadParams{}, nil, uploadHandler)
+		r.Run()
+		assert.Equal(t, "code 200,msg "+c.want+"\n", out.String())
+	}
+}
+
+func TestDownloadApi(t *testing.T) {
+	r, _ := New()
+	r.AddApiRoute("/export", "GET", "export users", nil, nil, downloadHandler)
+
+	w := performRequest(r, "GET", "/export", header{"Range", "bytes=0-6"})
+	assert.Equal(t, http.StatusPartialContent, w.Code)
+	assert.Equal(t, "id,name", w.Body.String())
+	assert.Equal(t, `attachment; filename=users.csv`, w.Header().Get("Content-Disposition"))
+	assert.Equal(t, "text/csv; charset=utf-8", w.Header().Get("Content-Type"))
+
+	w = performRequest(r, "GET", "/export?stream=true", header{"Range", "bytes=0-6"})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "id,name\n1,bob\n", w.Body.String())
+}
+
+func TestDownloadCli(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "download")
+	defer os.RemoveAll(dir)
+
+	for _, args := range [][]string{{"export"}, {"export", "--out", dir}} {
+		os.Args = append([]string{"-"}, args...)
+		r, _ := New()
+		out := &bytes.Buffer{}
+		r.cli.App.Writer = out
+		r.cli.App.ErrWriter = out
+		r.AddMultiRoute("/export", "GET", "export users", nil, nil, downloadHandler, Downloads())
+		r.Run()
+		if len(args) == 1 {
+			assert.Equal(t, "id,name\n1,bob\n", out.String())
+			continue
+		}
+		path := filepath.Join(dir, "users.csv")
+		assert.Equal(t, "saved "+path+" (14 bytes)\n", out.String())
+		b, _ := ioutil.ReadFile(path)
+		assert.Equal(t, "id,name\n1,bob\n", string(b))
+	}
+}
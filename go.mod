@@ -4,9 +4,14 @@ go 1.13
 
 require (
 	github.com/gin-gonic/gin v1.7.1
+	github.com/gorilla/websocket v1.4.2
+	github.com/peterh/liner v1.2.1
 	github.com/pkg/errors v0.9.1
 	github.com/stretchr/testify v1.4.0
+	github.com/ugorji/go/codec v1.1.7
 	github.com/urfave/cli/v2 v2.3.0
 	go.uber.org/zap v1.16.0
+	golang.org/x/crypto v0.0.0-20200622213623-75b288015ac9
 	gopkg.in/natefinch/lumberjack.v2 v2.0.0
+	gopkg.in/yaml.v2 v2.2.8
 )
@@ -0,0 +1,167 @@
+package handle
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// CachePolicy sets the caching headers of successful reads of a route
+type CachePolicy struct {
+	// Cache-Control header of successful reads, not sent if empty
+	CacheControl string
+	// Send weak etags, for bodies whose bytes may change while their meaning does not
+	WeakETag bool
+	// Do not compute etags of rendered bodies, versions set by handlers are still sent
+	NoETag bool
+}
+
+// Version identifies the state of a resource for conditional requests
+type Version struct {
+	// Opaque tag without quotes, no ETag is sent if empty
+	ETag string
+	Weak bool
+	// Time of the last change, no Last-Modified is sent if zero
+	ModTime time.Time
+}
+
+// Value of the ETag header of the version, empty if it has no tag
+func (v *Version) Tag() string {
+	if v.ETag == "" {
+		return ""
+	}
+	tag := `"` + strings.Trim(v.ETag, `"`) + `"`
+	if v.Weak {
+		return "W/" + tag
+	}
+	return tag
+}
+
+type cachePolicyKey struct{}
+
+// Return a copy of ctx carrying the cache policy of the route
+func ContextWithCachePolicy(ctx context.Context, policy *CachePolicy) context.Context {
+	return context.WithValue(ctx, cachePolicyKey{}, policy)
+}
+
+// Get the cache policy stored in ctx, nil if the route has none
+func CachePolicyFromContext(ctx context.Context) *CachePolicy {
+	if ctx == nil {
+		return nil
+	}
+	policy, _ := ctx.Value(cachePolicyKey{}).(*CachePolicy)
+	return policy
+}
+
+type versionKey struct{}
+
+// Return a copy of ctx carrying the current version of the resource
+func ContextWithVersion(ctx context.Context, v *Version) context.Context {
+	return context.WithValue(ctx, versionKey{}, v)
+}
+
+// Get the version stored in ctx, nil if it is unknown
+func VersionFromContext(ctx context.Context) *Version {
+	if ctx == nil {
+		return nil
+	}
+	v, _ := ctx.Value(versionKey{}).(*Version)
+	return v
+}
+
+// Set the ETag, Last-Modified and Cache-Control headers of a successful read
+func SetCacheHeaders(h http.Header, policy *CachePolicy, etag string, modTime time.Time) {
+	if etag != "" {
+		h.Set("ETag", etag)
+	}
+	if !modTime.IsZero() {
+		h.Set("Last-Modified", modTime.UTC().Format(http.TimeFormat))
+	}
+	if policy != nil && policy.CacheControl != "" {
+		h.Set("Cache-Control", policy.CacheControl)
+	}
+}
+
+// Check If-None-Match and If-Modified-Since of a read, true if the client has the current version
+func NotModified(req *http.Request, etag string, modTime time.Time) bool {
+	if inm := req.Header.Get("If-None-Match"); inm != "" {
+		return etag != "" && matchETag(inm, etag, false)
+	}
+	if ims := req.Header.Get("If-Modified-Since"); ims != "" && !modTime.IsZero() {
+		t, err := http.ParseTime(ims)
+		return err == nil && !modTime.Truncate(time.Second).After(t)
+	}
+	return false
+}
+
+// Check If-Match, If-Unmodified-Since and If-None-Match of a change
+// against the current version, exists is false if there is no resource
+func PreconditionHolds(req *http.Request, etag string, modTime time.Time, exists bool) bool {
+	if im := req.Header.Get("If-Match"); im != "" {
+		if !exists || !matchETag(im, etag, true) {
+			return false
+		}
+	} else if ius := req.Header.Get("If-Unmodified-Since"); ius != "" && exists {
+		t, err := http.ParseTime(ius)
+		if err != nil || modTime.IsZero() || modTime.Truncate(time.Second).After(t) {
+			return false
+		}
+	}
+	if inm := req.Header.Get("If-None-Match"); inm != "" && exists {
+		return !matchETag(inm, etag, false)
+	}
+	return true
+}
+
+// Check whether the list of entity tags of a conditional header matches etag,
+// weak tags never match a strong comparison
+func matchETag(list, etag string, strong bool) bool {
+	list = strings.TrimSpace(list)
+	if list == "*" {
+		return true
+	}
+	weak, opaque := splitETag(etag)
+	if opaque == "" || strong && weak {
+		return false
+	}
+	for list != "" {
+		list = strings.TrimLeft(list, " \t,")
+		w := strings.HasPrefix(list, "W/")
+		if w {
+			list = list[2:]
+		}
+		if !strings.HasPrefix(list, `"`) {
+			return false
+		}
+		end := strings.Index(list[1:], `"`)
+		if end < 0 {
+			return false
+		}
+		if list[:end+2] == opaque && !(strong && w) {
+			return true
+		}
+		list = list[end+2:]
+	}
+	return false
+}
+
+// Split an ETag header value into its weakness and quoted tag
+func splitETag(etag string) (bool, string) {
+	if strings.HasPrefix(etag, "W/") {
+		return true, etag[2:]
+	}
+	return false, etag
+}
+
+// Tag of a rendered body, bodies of other content types get other tags
+func bodyETag(contentType string, body []byte, weak bool) string {
+	h := sha256.New()
+	h.Write([]byte(contentType))
+	h.Write([]byte{0})
+	h.Write(body)
+	v := Version{ETag: base64.RawURLEncoding.EncodeToString(h.Sum(nil)[:16]), Weak: weak}
+	return v.Tag()
+}
@@ -0,0 +1,493 @@
+package handle
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+	"github.com/ugorji/go/codec"
+	"gopkg.in/yaml.v2"
+)
+
+// FormatParam is the default query parameter selecting a format by name, it takes precedence over Accept
+const FormatParam = "format"
+
+type formatParamKey struct{}
+
+// Return a copy of ctx selecting formats by the query parameter name, formats are
+// only negotiated by Accept if name is empty
+func ContextWithFormatParam(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, formatParamKey{}, name)
+}
+
+// Get the query parameter selecting formats in ctx, FormatParam if none was set
+func FormatParamFromContext(ctx context.Context) string {
+	if ctx == nil {
+		return FormatParam
+	}
+	if name, ok := ctx.Value(formatParamKey{}).(string); ok {
+		return name
+	}
+	return FormatParam
+}
+
+// ErrNotEncodable is returned by an encoder for data it has no representation of,
+// the next format accepted by the client is tried
+var ErrNotEncodable = errors.New("data can not be encoded in this format")
+
+// Encoder writes data in the format it is registered for
+type Encoder func(w io.Writer, data interface{}) error
+
+type encoding struct {
+	format string
+	// media types matched against Accept, the first one is sent as content type
+	mediaTypes []string
+	encode     Encoder
+}
+
+var (
+	encodingsMu sync.RWMutex
+	encodings   []*encoding
+)
+
+func init() {
+	RegisterEncoder("json", encodeJSON, "application/json; charset=utf-8")
+	RegisterEncoder("xml", encodeXML, "application/xml; charset=utf-8", "text/xml")
+	RegisterEncoder("yaml", encodeYAML, "application/x-yaml; charset=utf-8", "application/yaml", "text/yaml")
+	RegisterEncoder("msgpack", encodeMsgPack, "application/msgpack", "application/x-msgpack")
+	RegisterEncoder("csv", encodeCSV, "text/csv; charset=utf-8")
+	RegisterEncoder("text", encodeText, "text/plain; charset=utf-8")
+}
+
+// Register an encoder selected by ?format=format or by any of mediaTypes in Accept,
+// the first media type is sent as content type and a registered format is replaced
+func RegisterEncoder(format string, encoder Encoder, mediaTypes ...string) {
+	if format == "" || encoder == nil || len(mediaTypes) == 0 {
+		panic("handle: an encoder needs a format, a function and a media type")
+	}
+	e := &encoding{format: format, mediaTypes: mediaTypes, encode: encoder}
+	encodingsMu.Lock()
+	defer encodingsMu.Unlock()
+	for i, registered := range encodings {
+		if registered.format == format {
+			encodings[i] = e
+			return
+		}
+	}
+	encodings = append(encodings, e)
+}
+
+// Formats that can be selected, in order of registration
+func Formats() []string {
+	encodingsMu.RLock()
+	defer encodingsMu.RUnlock()
+	formats := make([]string, len(encodings))
+	for i, e := range encodings {
+		formats[i] = e.format
+	}
+	return formats
+}
+
+// Render data in the format asked for by the request, json if it does not ask,
+// 406 is answered if none of the accepted formats can represent data
+func Negotiate(c *gin.Context, code int, data interface{}) {
+	if contentType, body, ok := negotiate(c, data); ok {
+		c.Data(code, contentType, body)
+	}
+}
+
+// Encode data in the first accepted format that represents it, the error is answered if there is none
+func negotiate(c *gin.Context, data interface{}) (string, []byte, bool) {
+	// added, so Vary set by earlier middleware like cors is kept
+	if !varies(c.Writer.Header(), "Accept") {
+		c.Writer.Header().Add("Vary", "Accept")
+	}
+	status, msg := http.StatusNotAcceptable, "none of the accepted formats is available"
+	for _, e := range acceptedEncodings(c) {
+		var buf bytes.Buffer
+		err := e.encode(&buf, data)
+		if err == ErrNotEncodable {
+			continue
+		}
+		if err == nil {
+			return e.mediaTypes[0], buf.Bytes(), true
+		}
+		_ = c.Error(err)
+		status, msg = http.StatusInternalServerError, "response encoding failed"
+		break
+	}
+	body := ErrorBody(c.Request.Context(), status, msg)
+	if m, ok := body.(map[string]interface{}); ok && status == http.StatusNotAcceptable {
+		m["formats"] = Formats()
+	}
+	c.JSON(status, body)
+	return "", nil, false
+}
+
+// Encode data like negotiate did for contentType
+func encodeAs(contentType string, data interface{}) ([]byte, error) {
+	var encoder Encoder
+	encodingsMu.RLock()
+	for _, e := range encodings {
+		if e.mediaTypes[0] == contentType {
+			encoder = e.encode
+			break
+		}
+	}
+	encodingsMu.RUnlock()
+	if encoder == nil {
+		return nil, errors.Errorf("no encoder for %s", contentType)
+	}
+	var buf bytes.Buffer
+	err := encoder(&buf, data)
+	return buf.Bytes(), err
+}
+
+// Check whether h varies on the header name already
+func varies(h http.Header, name string) bool {
+	for _, v := range h["Vary"] {
+		for _, field := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(field), name) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Encodings to try in order, from the format parameter or from Accept
+func acceptedEncodings(c *gin.Context) []*encoding {
+	encodingsMu.RLock()
+	defer encodingsMu.RUnlock()
+	name := FormatParamFromContext(c.Request.Context())
+	if format := c.Query(name); name != "" && format != "" {
+		for _, e := range encodings {
+			if e.format == format {
+				return []*encoding{e}
+			}
+		}
+		return nil
+	}
+	ranges := parseAccept(c.GetHeader("Accept"))
+	if len(ranges) == 0 {
+		return encodings[:1]
+	}
+	var candidates []*encoding
+	seen := map[*encoding]bool{}
+	for _, r := range ranges {
+		for _, e := range encodings {
+			if !seen[e] && e.matches(r) {
+				seen[e] = true
+				candidates = append(candidates, e)
+			}
+		}
+	}
+	return candidates
+}
+
+// Wildcard ranges only match the content type sent, aliases are matched exactly
+func (e *encoding) matches(mediaRange string) bool {
+	if mediaRange == "*/*" {
+		return true
+	}
+	for i, t := range e.mediaTypes {
+		mediaType, _, err := mime.ParseMediaType(t)
+		if err != nil {
+			continue
+		}
+		if mediaRange == mediaType {
+			return true
+		}
+		if i == 0 && strings.HasSuffix(mediaRange, "/*") && strings.HasPrefix(mediaType, strings.TrimSuffix(mediaRange, "*")) {
+			return true
+		}
+	}
+	return false
+}
+
+// Media ranges of an Accept header ordered by quality, ranges with q=0 are dropped
+//
+// Streams are negotiated by Progress and Send, their types alone leave the choice to the default
+func parseAccept(accept string) []string {
+	type mediaRange struct {
+		name string
+		q    float64
+	}
+	var ranges []mediaRange
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil || mediaType == eventStreamType || mediaType == ndjsonType || mediaType == "application/jsonl" {
+			continue
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+		if q > 0 {
+			ranges = append(ranges, mediaRange{mediaType, q})
+		}
+	}
+	sort.SliceStable(ranges, func(i, j int) bool {
+		return ranges[i].q > ranges[j].q
+	})
+	names := make([]string, len(ranges))
+	for i, r := range ranges {
+		names[i] = r.name
+	}
+	return names
+}
+
+func encodeJSON(w io.Writer, data interface{}) error {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(b)
+	return err
+}
+
+// Encode the json form of data so keys match the other formats
+func encodeYAML(w io.Writer, data interface{}) error {
+	var generic interface{}
+	if err := roundTrip(data, &generic); err != nil {
+		return err
+	}
+	b, err := yaml.Marshal(generic)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(b)
+	return err
+}
+
+func encodeMsgPack(w io.Writer, data interface{}) error {
+	var mh codec.MsgpackHandle
+	mh.TypeInfos = codec.NewTypeInfos([]string{"json"})
+	return codec.NewEncoder(w, &mh).Encode(data)
+}
+
+// Encode structs with encoding/xml if it can, maps and other values as
+// elements named after their json keys under a <response> root
+func encodeXML(w io.Writer, data interface{}) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	if v := reflect.Indirect(reflect.ValueOf(data)); v.Kind() == reflect.Struct {
+		if b, err := xml.Marshal(data); err == nil {
+			_, err = w.Write(b)
+			return err
+		}
+	}
+	var generic interface{}
+	if err := roundTrip(data, &generic); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	if err := encodeXMLValue(enc, "response", generic); err != nil {
+		return err
+	}
+	return enc.Flush()
+}
+
+func encodeXMLValue(enc *xml.Encoder, name string, v interface{}) error {
+	start := xml.StartElement{Name: xml.Name{Local: xmlName(name)}}
+	if err := enc.EncodeToken(start); err != nil {
+		return err
+	}
+	switch v := v.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if err := encodeXMLValue(enc, k, v[k]); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		for _, item := range v {
+			if err := encodeXMLValue(enc, "item", item); err != nil {
+				return err
+			}
+		}
+	case nil:
+	default:
+		if err := enc.EncodeToken(xml.CharData(fmt.Sprint(v))); err != nil {
+			return err
+		}
+	}
+	return enc.EncodeToken(start.End())
+}
+
+// Replace the characters of a json key not allowed in an element name
+func xmlName(key string) string {
+	var b strings.Builder
+	for i, r := range key {
+		switch {
+		case r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z':
+		case i > 0 && (r == '-' || r == '.' || r >= '0' && r <= '9'):
+		default:
+			r = '_'
+		}
+		b.WriteRune(r)
+	}
+	if b.Len() == 0 {
+		return "_"
+	}
+	return b.String()
+}
+
+// Encode a slice of structs or maps as a header row and one row per item
+func encodeCSV(w io.Writer, data interface{}) error {
+	v := reflect.ValueOf(data)
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return ErrNotEncodable
+	}
+	rows := make([]map[string]interface{}, 0, v.Len())
+	var columns []string
+	for i := 0; i < v.Len(); i++ {
+		item := v.Index(i)
+		for item.Kind() == reflect.Ptr || item.Kind() == reflect.Interface {
+			item = item.Elem()
+		}
+		if item.Kind() != reflect.Struct && item.Kind() != reflect.Map {
+			return ErrNotEncodable
+		}
+		var row map[string]interface{}
+		if err := roundTrip(item.Interface(), &row); err != nil || row == nil {
+			return ErrNotEncodable
+		}
+		if item.Kind() == reflect.Struct && columns == nil {
+			columns = structColumns(item.Type())
+		}
+		rows = append(rows, row)
+	}
+	if columns == nil {
+		columns = mapColumns(rows)
+	}
+	cw := csv.NewWriter(w)
+	if err := cw.Write(columns); err != nil {
+		return err
+	}
+	for _, row := range rows {
+		record := make([]string, len(columns))
+		for i, column := range columns {
+			record[i] = csvValue(row[column])
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// Json names of the exported fields of t in declaration order
+func structColumns(t reflect.Type) []string {
+	var columns []string
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			if field.Anonymous && field.Type.Kind() == reflect.Struct {
+				columns = append(columns, structColumns(field.Type)...)
+				continue
+			}
+			name = field.Name
+		}
+		columns = append(columns, name)
+	}
+	return columns
+}
+
+func mapColumns(rows []map[string]interface{}) []string {
+	seen := map[string]bool{}
+	var columns []string
+	for _, row := range rows {
+		for k := range row {
+			if !seen[k] {
+				seen[k] = true
+				columns = append(columns, k)
+			}
+		}
+	}
+	sort.Strings(columns)
+	return columns
+}
+
+func csvValue(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case map[string]interface{}, []interface{}:
+		b, _ := json.Marshal(v)
+		return string(b)
+	}
+	return fmt.Sprint(v)
+}
+
+// Encode strings, errors, stringers and scalars as text
+func encodeText(w io.Writer, data interface{}) error {
+	var s string
+	switch v := data.(type) {
+	case string:
+		s = v
+	case []byte:
+		s = string(v)
+	case time.Time:
+		s = v.Format(time.RFC3339Nano)
+	case error:
+		s = v.Error()
+	case fmt.Stringer:
+		s = v.String()
+	default:
+		switch reflect.ValueOf(data).Kind() {
+		case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+			reflect.Float32, reflect.Float64:
+			s = fmt.Sprint(data)
+		default:
+			return ErrNotEncodable
+		}
+	}
+	_, err := io.WriteString(w, s)
+	return err
+}
+
+// Convert v to the generic values of its json form
+func roundTrip(v interface{}, out interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, out)
+}
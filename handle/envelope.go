@@ -0,0 +1,194 @@
+package handle
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// LimitParam is the parameter holding the size of a page
+	LimitParam = "limit"
+	// CursorParam is the parameter holding the position a page starts at
+	CursorParam = "cursor"
+)
+
+// Envelope wraps all output of a router once enabled, errors leave data empty
+type Envelope struct {
+	Data  interface{} `json:"data"`
+	Error *ErrorInfo  `json:"error,omitempty"`
+	Meta  Meta        `json:"meta"`
+}
+
+// ErrorInfo describes a failed call
+type ErrorInfo struct {
+	Status  int    `json:"status"`
+	Message string `json:"message"`
+	// the body the handler responded with, if it said more than the message
+	Details interface{} `json:"details,omitempty"`
+}
+
+// Meta is sent along the data of every enveloped response
+type Meta struct {
+	RequestID  string      `json:"request_id,omitempty"`
+	Pagination *Pagination `json:"pagination,omitempty"`
+	Warnings   []string    `json:"warnings,omitempty"`
+}
+
+// Pagination describes the page of a list a response holds
+type Pagination struct {
+	Limit      int    `json:"limit"`
+	Cursor     string `json:"cursor,omitempty"`
+	NextCursor string `json:"next_cursor,omitempty"`
+	// total number of items, nil if it is unknown
+	Total *int64 `json:"total,omitempty"`
+}
+
+// EnvelopeFunc shapes an envelope into the body that is sent
+type EnvelopeFunc func(e *Envelope) interface{}
+
+// Send envelopes as they are
+func DefaultEnvelope(e *Envelope) interface{} {
+	return e
+}
+
+type envelopeKey struct{}
+
+// Return a copy of ctx wrapping output with shape
+func ContextWithEnvelope(ctx context.Context, shape EnvelopeFunc) context.Context {
+	return context.WithValue(ctx, envelopeKey{}, shape)
+}
+
+// Get the envelope shape stored in ctx, nil if output is not wrapped
+func EnvelopeFromContext(ctx context.Context) EnvelopeFunc {
+	if ctx == nil {
+		return nil
+	}
+	shape, _ := ctx.Value(envelopeKey{}).(EnvelopeFunc)
+	return shape
+}
+
+// Create the envelope of a response, error statuses turn data into the error
+func NewEnvelope(code int, data interface{}, meta Meta) *Envelope {
+	if code < http.StatusBadRequest {
+		return &Envelope{Data: data, Meta: meta}
+	}
+	info := &ErrorInfo{Status: code, Message: messageOf(code, data)}
+	switch data.(type) {
+	case string, error, nil:
+	default:
+		info.Details = data
+	}
+	return &Envelope{Error: info, Meta: meta}
+}
+
+// Body of an error answered by the router itself, an envelope if ctx enables them
+func ErrorBody(ctx context.Context, code int, msg string) interface{} {
+	requestID := RequestIDFromContext(ctx)
+	if shape := EnvelopeFromContext(ctx); shape != nil {
+		return shape(NewEnvelope(code, msg, Meta{RequestID: requestID}))
+	}
+	body := map[string]interface{}{"code": 1, "msg": msg}
+	if requestID != "" {
+		body["request_id"] = requestID
+	}
+	return body
+}
+
+// Message of an error body, the status text if it has none
+func messageOf(code int, data interface{}) string {
+	switch v := data.(type) {
+	case string:
+		return v
+	case error:
+		return v.Error()
+	case map[string]interface{}:
+		for _, key := range []string{"msg", "message", "error"} {
+			if msg, ok := v[key].(string); ok && msg != "" {
+				return msg
+			}
+		}
+	case map[string]string:
+		for _, key := range []string{"msg", "message", "error"} {
+			if msg := v[key]; msg != "" {
+				return msg
+			}
+		}
+	}
+	return strings.ToLower(http.StatusText(code))
+}
+
+// Page is the window of a list selected by the limit and cursor params
+type Page struct {
+	Limit  int
+	Cursor string
+	next   string
+	total  *int64
+}
+
+// Read the page asked for through action, limit defaults to def and is capped at max
+//
+// The params of the route need limit and cursor fields so both transports accept them
+func Paginate(action Action, def, max int) (*Page, error) {
+	page := &Page{Limit: def, Cursor: action.String(CursorParam)}
+	if s := action.String(LimitParam); s != "" {
+		limit, err := strconv.Atoi(s)
+		if err != nil || limit < 1 {
+			return nil, errors.Errorf("%s must be a positive number", LimitParam)
+		}
+		page.Limit = limit
+	}
+	if max > 0 && page.Limit > max {
+		page.Limit = max
+	}
+	return page, nil
+}
+
+// Set the cursor of the next page, empty on the last page
+func (p *Page) SetNext(cursor string) {
+	p.next = cursor
+}
+
+// Set the total number of items in the list
+func (p *Page) SetTotal(n int64) {
+	p.total = &n
+}
+
+// Pagination of the page sent in meta
+func (p *Page) Pagination() *Pagination {
+	return &Pagination{Limit: p.Limit, Cursor: p.Cursor, NextCursor: p.next, Total: p.total}
+}
+
+// Warning header value of msg, envelopes carry warnings in meta instead
+func warningHeader(msg string) string {
+	escaped := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\r", " ", "\n", " ").Replace(msg)
+	return `299 - "` + escaped + `"`
+}
+
+// Link header of the first and next pages of the list at u
+func linkHeader(u *url.URL, p *Pagination) string {
+	link := func(rel, cursor string) string {
+		target := *u
+		query := target.Query()
+		query.Set(LimitParam, strconv.Itoa(p.Limit))
+		if cursor == "" {
+			query.Del(CursorParam)
+		} else {
+			query.Set(CursorParam, cursor)
+		}
+		target.RawQuery = query.Encode()
+		return "<" + target.RequestURI() + `>; rel="` + rel + `"`
+	}
+	var links []string
+	if p.NextCursor != "" {
+		links = append(links, link("next", p.NextCursor))
+	}
+	if p.Cursor != "" {
+		links = append(links, link("first", ""))
+	}
+	return strings.Join(links, ", ")
+}
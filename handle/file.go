@@ -0,0 +1,162 @@
+package handle
+
+import (
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+	"github.com/urfave/cli/v2"
+	"github.com/zfs123/go-ac-router/utils"
+)
+
+// StdinPath is the path reading a cli file parameter from stdin
+const StdinPath = "-"
+
+// File is an uploaded file, a multipart form field on the api and a path or stdin on the cli
+//
+// Declare a *File field in the params struct to receive one
+type File struct {
+	Name        string `json:"name" form:"-"`
+	ContentType string `json:"content_type" form:"-"`
+	// Size in bytes, -1 if it is unknown
+	Size int64 `json:"size" form:"-"`
+	open func() (io.ReadCloser, error)
+}
+
+var fileType = reflect.TypeOf(&File{})
+
+// Open the content of the file
+func (f *File) Open() (io.ReadCloser, error) {
+	return f.open()
+}
+
+// Create a file of a multipart form field
+func newFormFile(fh *multipart.FileHeader) *File {
+	return &File{
+		Name:        fh.Filename,
+		ContentType: fh.Header.Get("Content-Type"),
+		Size:        fh.Size,
+		open: func() (io.ReadCloser, error) {
+			return fh.Open()
+		},
+	}
+}
+
+// Create a file of a cli path, stdin is read for StdinPath
+func newCliFile(c *cli.Context, path string) (*File, error) {
+	if path == StdinPath {
+		return &File{Name: "stdin", Size: -1, open: func() (io.ReadCloser, error) {
+			return ioutil.NopCloser(c.App.Reader), nil
+		}}, nil
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "open file")
+	}
+	if info.IsDir() {
+		return nil, errors.Errorf("%s is a directory", path)
+	}
+	return &File{
+		Name:        filepath.Base(path),
+		ContentType: mime.TypeByExtension(filepath.Ext(path)),
+		Size:        info.Size(),
+		open: func() (io.ReadCloser, error) {
+			return os.Open(path)
+		},
+	}, nil
+}
+
+// Set the *File fields of params to the files get returns, fields it returns nil for are left alone
+func bindFiles(params interface{}, get func(name string) (*File, error)) error {
+	var bindErr error
+	_ = utils.RangeStruct(params, func(value reflect.Value, field reflect.StructField) bool {
+		name := utils.GetForm(field)
+		if name == "" || field.Type != fileType || !value.CanSet() {
+			return true
+		}
+		file, err := get(name)
+		if err != nil {
+			bindErr = errors.Wrapf(err, "bind %s", name)
+			return false
+		}
+		if file != nil {
+			value.Set(reflect.ValueOf(file))
+		}
+		return true
+	})
+	return bindErr
+}
+
+// Check whether params has *File fields
+func hasFileFields(params interface{}) bool {
+	found := false
+	_ = utils.RangeStruct(params, func(value reflect.Value, field reflect.StructField) bool {
+		found = field.Type == fileType
+		return !found
+	})
+	return found
+}
+
+// Bind the file fields of params from the multipart form of the request
+func bindFormFiles(c *gin.Context, params interface{}) error {
+	return bindFiles(params, func(name string) (*File, error) {
+		fh, err := c.FormFile(name)
+		if err == http.ErrMissingFile || err == http.ErrNotMultipart {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		return newFormFile(fh), nil
+	})
+}
+
+// Download is content sent as a file
+type Download struct {
+	// Name suggested to the client, the content type is derived from it if empty
+	Name        string
+	ContentType string
+	// Modification time, used for conditional and range requests
+	ModTime time.Time
+	// Content of the file, ranges are served if it is an io.ReadSeeker,
+	// it is closed once sent if it is an io.Closer
+	Content io.Reader
+	// Ask the client to display the file instead of saving it
+	Inline bool
+}
+
+// Close the content once it was sent if it is an io.Closer
+func (d Download) close() {
+	if closer, ok := d.Content.(io.Closer); ok {
+		_ = closer.Close()
+	}
+}
+
+func (d Download) contentType() string {
+	if d.ContentType != "" {
+		return d.ContentType
+	}
+	if t := mime.TypeByExtension(filepath.Ext(d.Name)); t != "" {
+		return t
+	}
+	return "application/octet-stream"
+}
+
+func (d Download) contentDisposition() string {
+	disposition := "attachment"
+	if d.Inline {
+		disposition = "inline"
+	}
+	if d.Name == "" {
+		return disposition
+	}
+	return mime.FormatMediaType(disposition, map[string]string{"filename": d.Name})
+}
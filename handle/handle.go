@@ -1,13 +1,18 @@
 package handle
 
 import (
+	"context"
 	"reflect"
 	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
 	"github.com/urfave/cli/v2"
+	"github.com/zfs123/go-ac-router/auth"
+	"github.com/zfs123/go-ac-router/trace"
 	"github.com/zfs123/go-ac-router/utils"
+	"go.uber.org/zap"
 )
 
 const (
@@ -27,6 +32,12 @@ type Action interface {
 	Uint64(name string) uint64
 	GetActionType() uint8
 	ShouldBind(params interface{}) error
+	SpanContext() trace.SpanContext
+	RequestID() string
+	Logger() *zap.Logger
+	Principal() *auth.Principal
+	Context() context.Context
+	DryRun() bool
 }
 
 // CliAction is used to get input from http request
@@ -107,7 +118,50 @@ func (api *ApiAction) GetActionType() uint8 {
 
 // Should bind
 func (api *ApiAction) ShouldBind(params interface{}) error {
-	return api.C.ShouldBind(params)
+	if !hasFileFields(params) {
+		return api.C.ShouldBind(params)
+	}
+	// files are bound first so their required rules are checked by gin,
+	// which only gets the values of multipart forms as it can not bind *File
+	if err := bindFormFiles(api.C, params); err != nil {
+		return err
+	}
+	b := binding.Default(api.C.Request.Method, api.C.ContentType())
+	if b == binding.FormMultipart {
+		b = binding.Form
+	}
+	return api.C.ShouldBindWith(params, b)
+}
+
+// Get the span context of the request, invalid if tracing is disabled
+func (api *ApiAction) SpanContext() trace.SpanContext {
+	return trace.SpanFromContext(api.C.Request.Context()).SpanContext()
+}
+
+// Get the id of the request
+func (api *ApiAction) RequestID() string {
+	return RequestIDFromContext(api.C.Request.Context())
+}
+
+// Get a logger carrying the request id and trace of the request
+func (api *ApiAction) Logger() *zap.Logger {
+	return requestLogger(api.C.Request.Context())
+}
+
+// Get the authenticated caller, nil if the route is open
+func (api *ApiAction) Principal() *auth.Principal {
+	return auth.PrincipalFromContext(api.C.Request.Context())
+}
+
+// Get the context of the request, it is cancelled when the client disconnects,
+// the route times out or the server shuts down
+func (api *ApiAction) Context() context.Context {
+	return api.C.Request.Context()
+}
+
+// Check whether the changes of a mutating route should only be reported, set by the dry_run parameter
+func (api *ApiAction) DryRun() bool {
+	return DryRunFromContext(api.C.Request.Context())
 }
 
 // CliAction is used to get input from command
@@ -165,8 +219,47 @@ func (cli *CliAction) GetActionType() uint8 {
 	return CliTypeAction
 }
 
+// Get the span context of the command, invalid if tracing is disabled
+func (cli *CliAction) SpanContext() trace.SpanContext {
+	return trace.SpanFromContext(cli.C.Context).SpanContext()
+}
+
+// Get the id of the command invocation
+func (cli *CliAction) RequestID() string {
+	return RequestIDFromContext(cli.C.Context)
+}
+
+// Get a logger carrying the request id and trace of the command
+func (cli *CliAction) Logger() *zap.Logger {
+	return requestLogger(cli.C.Context)
+}
+
+// Get the caller of the command, nil for local invocations
+func (cli *CliAction) Principal() *auth.Principal {
+	return auth.PrincipalFromContext(cli.C.Context)
+}
+
+// Get the context of the command, it is cancelled when the process is interrupted
+func (cli *CliAction) Context() context.Context {
+	return cli.C.Context
+}
+
+// Check whether the changes of a mutating route should only be reported, set by --dry-run
+func (cli *CliAction) DryRun() bool {
+	return DryRunFromContext(cli.C.Context)
+}
+
 // Currently supported field types are not perfect
 func (cli *CliAction) ShouldBind(params interface{}) error {
+	err := bindFiles(params, func(name string) (*File, error) {
+		if path := cli.C.String(name); path != "" {
+			return newCliFile(cli.C, path)
+		}
+		return nil, nil
+	})
+	if err != nil {
+		return err
+	}
 	return utils.RangeStruct(params, func(value reflect.Value, field reflect.StructField) bool {
 		alia := utils.GetForm(field)
 		if alia == "" {
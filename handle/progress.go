@@ -0,0 +1,73 @@
+package handle
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"strings"
+)
+
+// Progress of a long running handler
+type Progress struct {
+	// Percent done from 0 to 100, negative if unknown
+	Percent float64 `json:"percent"`
+	Message string  `json:"message,omitempty"`
+	// Current step and number of steps, ignored if Steps is zero
+	Step  int `json:"step,omitempty"`
+	Steps int `json:"steps,omitempty"`
+}
+
+// Percent done, derived from the steps if not set
+func (p Progress) Done() float64 {
+	if p.Percent == 0 && p.Steps > 0 {
+		return float64(p.Step) * 100 / float64(p.Steps)
+	}
+	return p.Percent
+}
+
+var spinner = []string{"|", "/", "-", "\\"}
+
+// progressBar renders progress on a terminal or as plain lines
+type progressBar struct {
+	w      io.Writer
+	tty    bool
+	frame  int
+	active bool
+}
+
+func (pb *progressBar) render(p Progress) {
+	var b strings.Builder
+	done := p.Done()
+	if done < 0 {
+		b.WriteString(spinner[pb.frame%len(spinner)])
+		pb.frame++
+	} else {
+		done = math.Min(done, 100)
+		if pb.tty {
+			filled := int(done / 5)
+			b.WriteString("[" + strings.Repeat("#", filled) + strings.Repeat(".", 20-filled) + "] ")
+		}
+		b.WriteString(fmt.Sprintf("%3.0f%%", done))
+	}
+	if p.Steps > 0 {
+		b.WriteString(fmt.Sprintf(" step %d/%d", p.Step, p.Steps))
+	}
+	if p.Message != "" {
+		b.WriteString(" " + p.Message)
+	}
+	if pb.tty {
+		// redraw the line in place
+		_, _ = fmt.Fprintf(pb.w, "\r\033[K%s", b.String())
+		pb.active = true
+		return
+	}
+	_, _ = fmt.Fprintf(pb.w, "progress %s\n", b.String())
+}
+
+// Finish the progress line before other output
+func (pb *progressBar) finish() {
+	if pb.active {
+		_, _ = fmt.Fprintln(pb.w)
+		pb.active = false
+	}
+}
@@ -0,0 +1,70 @@
+package handle
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"github.com/zfs123/go-ac-router/logger"
+	"github.com/zfs123/go-ac-router/trace"
+	"go.uber.org/zap"
+)
+
+type requestIDKey struct{}
+
+// Return a copy of ctx carrying the request id
+func ContextWithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// Get the request id stored in ctx, empty if there is none
+func RequestIDFromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// ErrBodyTooLarge is returned when a request body is read beyond its limit
+var ErrBodyTooLarge = errors.New("request body too large")
+
+type bodyLimitKey struct{}
+
+// Return a copy of ctx asking exceeded whether the request body went over its limit
+func ContextWithBodyLimit(ctx context.Context, exceeded func() bool) context.Context {
+	return context.WithValue(ctx, bodyLimitKey{}, exceeded)
+}
+
+// Check whether the request body of ctx went over its limit, errors are answered with 413 then
+func BodyLimitExceeded(ctx context.Context) bool {
+	if ctx == nil {
+		return false
+	}
+	exceeded, _ := ctx.Value(bodyLimitKey{}).(func() bool)
+	return exceeded != nil && exceeded()
+}
+
+type dryRunKey struct{}
+
+// Return a copy of ctx marking the call as a dry run
+func ContextWithDryRun(ctx context.Context, dryRun bool) context.Context {
+	return context.WithValue(ctx, dryRunKey{}, dryRun)
+}
+
+// Check whether ctx belongs to a dry run
+func DryRunFromContext(ctx context.Context) bool {
+	if ctx == nil {
+		return false
+	}
+	dryRun, _ := ctx.Value(dryRunKey{}).(bool)
+	return dryRun
+}
+
+// Create a logger carrying the request id and trace of ctx
+func requestLogger(ctx context.Context) *zap.Logger {
+	l := logger.WithTrace(trace.SpanFromContext(ctx).SpanContext())
+	if id := RequestIDFromContext(ctx); id != "" {
+		l = l.With(zap.String("request_id", id))
+	}
+	return l
+}
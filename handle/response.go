@@ -3,10 +3,16 @@ package handle
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
+	"os"
+	"path/filepath"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
 	"github.com/urfave/cli/v2"
+	"github.com/zfs123/go-ac-router/utils"
 )
 
 // Response is used to response
@@ -14,58 +20,389 @@ type Response interface {
 	Response(code int, data interface{})
 	SendSimpleOk(msg string)
 	SendSimpleFail(msg string)
+	Progress(p Progress)
+	// Send one item of a stream, apis answer server-sent events if the client
+	// accepts them and json lines otherwise, cli commands always print json
+	// lines with strings as is; items are never wrapped in the envelope
+	Send(item interface{}) error
+	SendFile(d Download) error
+	SetPage(p *Page)
+	Warn(msg string)
+	SetVersion(v Version)
 }
 
 // ApiResponse implemented response of http request
 type ApiResponse struct {
 	C *gin.Context
+	// content type of the stream once progress or items were sent, empty before
+	streaming string
+	// number of items sent
+	sent    int
+	meta    Meta
+	version *Version
 }
 
 // Create an api response
 func NewApiResponse(c *gin.Context) *ApiResponse {
-	return &ApiResponse{c}
+	return &ApiResponse{C: c}
 }
 
-// Output json
+// Output data in the format negotiated with the client, json by default
+//
+// Successful reads are tagged and answered with 304 if the client has them already,
+// errors answered after the request body went over its limit become 413
 func (resp *ApiResponse) Response(code int, data interface{}) {
-	resp.C.JSON(code, data)
+	ctx := resp.C.Request.Context()
+	shape := EnvelopeFromContext(ctx)
+	if code >= http.StatusBadRequest && BodyLimitExceeded(ctx) {
+		code, data = http.StatusRequestEntityTooLarge, ErrBodyTooLarge.Error()
+		if shape == nil {
+			data = ErrorBody(ctx, code, ErrBodyTooLarge.Error())
+		}
+	}
+	body := data
+	meta := resp.meta
+	if shape != nil {
+		meta.RequestID = RequestIDFromContext(ctx)
+		body = shape(NewEnvelope(code, data, meta))
+	}
+	if resp.streaming != "" {
+		resp.writeStream("result", map[string]interface{}{"code": code, "data": body})
+		return
+	}
+	if p := resp.meta.Pagination; p != nil {
+		if link := linkHeader(resp.C.Request.URL, p); link != "" {
+			resp.C.Header("Link", link)
+		}
+	}
+	if shape == nil {
+		for _, warning := range resp.meta.Warnings {
+			resp.C.Writer.Header().Add("Warning", warningHeader(warning))
+		}
+	}
+	method := resp.C.Request.Method
+	if code < http.StatusOK || code >= http.StatusMultipleChoices || method != http.MethodGet && method != http.MethodHead {
+		Negotiate(resp.C, code, body)
+		return
+	}
+	contentType, b, ok := negotiate(resp.C, body)
+	if !ok {
+		return
+	}
+	policy := CachePolicyFromContext(ctx)
+	version := resp.version
+	if version == nil {
+		version = VersionFromContext(ctx)
+	}
+	var etag string
+	var modTime time.Time
+	if version != nil {
+		etag, modTime = version.Tag(), version.ModTime
+	}
+	if etag == "" && (policy == nil || !policy.NoETag) {
+		tagged := b
+		if shape != nil && meta.RequestID != "" {
+			// request ids differ on every call, tag the envelope without it
+			meta.RequestID = ""
+			tagged, _ = encodeAs(contentType, shape(NewEnvelope(code, data, meta)))
+		}
+		etag = bodyETag(contentType, tagged, policy != nil && policy.WeakETag)
+	}
+	SetCacheHeaders(resp.C.Writer.Header(), policy, etag, modTime)
+	if NotModified(resp.C.Request, etag, modTime) {
+		resp.C.Status(http.StatusNotModified)
+		resp.C.Writer.WriteHeaderNow()
+		return
+	}
+	resp.C.Data(code, contentType, b)
 }
 
 // Simple send success
 func (resp *ApiResponse) SendSimpleOk(msg string) {
-	resp.C.JSON(http.StatusOK, map[string]interface{}{"code": 0, "msg": msg})
+	if EnvelopeFromContext(resp.C.Request.Context()) != nil {
+		resp.Response(http.StatusOK, map[string]interface{}{"message": msg})
+		return
+	}
+	resp.Response(http.StatusOK, map[string]interface{}{"code": 0, "msg": msg})
 }
 
 // Simple send error
 func (resp *ApiResponse) SendSimpleFail(msg string) {
-	resp.C.JSON(http.StatusInternalServerError, map[string]interface{}{"code": 1, "msg": msg})
+	ctx := resp.C.Request.Context()
+	if EnvelopeFromContext(ctx) != nil {
+		resp.Response(http.StatusInternalServerError, msg)
+		return
+	}
+	resp.Response(http.StatusInternalServerError, ErrorBody(ctx, http.StatusInternalServerError, msg))
+}
+
+// Describe the page of a list sent by the next response, links to the next and first pages are added
+func (resp *ApiResponse) SetPage(p *Page) {
+	resp.meta.Pagination = p.Pagination()
+}
+
+// Add a warning to the meta of the next response, it is sent in a Warning header without envelope
+func (resp *ApiResponse) Warn(msg string) {
+	resp.meta.Warnings = append(resp.meta.Warnings, msg)
+}
+
+// Set the version of the resource sent by the next response, it replaces the etag of the body
+func (resp *ApiResponse) SetVersion(v Version) {
+	resp.version = &v
+}
+
+// Merge pagination and warnings kept elsewhere into the meta of the next response
+func (resp *ApiResponse) SetMeta(meta Meta) {
+	if meta.Pagination != nil {
+		resp.meta.Pagination = meta.Pagination
+	}
+	resp.meta.Warnings = append(resp.meta.Warnings, meta.Warnings...)
+}
+
+// Send progress as server-sent events or json lines if the client accepts them,
+// the status is fixed to 200 once progress was sent
+func (resp *ApiResponse) Progress(p Progress) {
+	if resp.streaming == "" {
+		mode := streamType(resp.C)
+		if mode == "" {
+			return
+		}
+		resp.startStream(mode)
+	}
+	resp.writeStream("progress", p)
+}
+
+// Send one item of a stream, as a server-sent event if the client accepts
+// them and as a json line otherwise, an error is returned once the client is gone
+func (resp *ApiResponse) Send(item interface{}) error {
+	if err := resp.C.Request.Context().Err(); err != nil {
+		return err
+	}
+	if resp.streaming == "" {
+		mode := streamType(resp.C)
+		if mode == "" {
+			mode = ndjsonType
+		}
+		resp.startStream(mode)
+	}
+	resp.sent++
+	var err error
+	if resp.streaming == eventStreamType {
+		err = writeItemEvent(resp.C.Writer, resp.sent, item)
+	} else {
+		err = writeItemLine(resp.C.Writer, item)
+	}
+	if err != nil {
+		return err
+	}
+	resp.C.Writer.Flush()
+	return nil
+}
+
+// Send content as a file, ranges and conditional requests are served if it is seekable
+func (resp *ApiResponse) SendFile(d Download) error {
+	defer d.close()
+	if resp.streaming != "" {
+		return errors.New("a stream was already started")
+	}
+	header := resp.C.Writer.Header()
+	header.Set("Content-Disposition", d.contentDisposition())
+	header.Set("Content-Type", d.contentType())
+	if rs, ok := d.Content.(io.ReadSeeker); ok {
+		http.ServeContent(resp.C.Writer, resp.C.Request, d.Name, d.ModTime, rs)
+		return nil
+	}
+	if !d.ModTime.IsZero() {
+		header.Set("Last-Modified", d.ModTime.UTC().Format(http.TimeFormat))
+	}
+	resp.C.Status(http.StatusOK)
+	_, err := io.Copy(resp.C.Writer, d.Content)
+	return err
+}
+
+func (resp *ApiResponse) startStream(mode string) {
+	resp.streaming = mode
+	header := resp.C.Writer.Header()
+	header.Set("Content-Type", mode)
+	header.Set("Cache-Control", "no-cache")
+	header.Set("X-Accel-Buffering", "no")
+	resp.C.Status(http.StatusOK)
+	resp.C.Writer.WriteHeaderNow()
+}
+
+func (resp *ApiResponse) writeStream(event string, data interface{}) {
+	if resp.streaming == eventStreamType {
+		_ = writeEvent(resp.C.Writer, event, data)
+	} else {
+		_ = writeLine(resp.C.Writer, event, data)
+	}
+	resp.C.Writer.Flush()
 }
 
 // ApiResponse implemented response of command
 type CliResponse struct {
-	C *cli.Context
+	C        *cli.Context
+	code     int
+	data     interface{}
+	progress *progressBar
+	meta     Meta
 }
 
 // Create an cli response
 func NewCliResponse(c *cli.Context) *CliResponse {
-	return &CliResponse{c}
+	return &CliResponse{C: c}
 }
 
-// Format cli output
+// Format cli output, an envelope is printed as one json line
 func (resp *CliResponse) Response(code int, data interface{}) {
+	resp.finishProgress()
+	resp.code = code
+	resp.data = data
+	if shape := EnvelopeFromContext(resp.C.Context); shape != nil {
+		meta := resp.meta
+		meta.RequestID = RequestIDFromContext(resp.C.Context)
+		_ = writeItemLine(resp.C.App.Writer, shape(NewEnvelope(code, data, meta)))
+		return
+	}
 	b, err := json.Marshal(data)
 	if err != nil {
 		_, _ = fmt.Fprintf(resp.C.App.Writer, "code %d, msg %s, err %s\n", code, "output failed", err.Error())
 	}
 	_, _ = fmt.Fprintf(resp.C.App.Writer, "code %d,msg %s\n", code, string(b))
+	resp.printMeta()
 }
 
 // Simple send success
 func (resp *CliResponse) SendSimpleOk(msg string) {
+	if EnvelopeFromContext(resp.C.Context) != nil {
+		resp.Response(http.StatusOK, map[string]interface{}{"message": msg})
+		return
+	}
+	resp.finishProgress()
+	resp.code = http.StatusOK
+	resp.data = msg
 	_, _ = fmt.Fprintln(resp.C.App.Writer, msg)
+	resp.printMeta()
 }
 
 // Simple send error
 func (resp *CliResponse) SendSimpleFail(msg string) {
+	if EnvelopeFromContext(resp.C.Context) != nil {
+		resp.Response(http.StatusInternalServerError, msg)
+		return
+	}
+	resp.finishProgress()
+	resp.code = http.StatusInternalServerError
+	resp.data = msg
+	if id := RequestIDFromContext(resp.C.Context); id != "" {
+		_, _ = fmt.Fprintf(resp.C.App.Writer, "%s (request id %s)\n", msg, id)
+		return
+	}
 	_, _ = fmt.Fprintln(resp.C.App.Writer, msg)
 }
+
+// Describe the page of a list sent by the next response
+func (resp *CliResponse) SetPage(p *Page) {
+	resp.meta.Pagination = p.Pagination()
+}
+
+// Add a warning to the next response
+func (resp *CliResponse) Warn(msg string) {
+	resp.meta.Warnings = append(resp.meta.Warnings, msg)
+}
+
+// Versions only matter to conditional requests of the api
+func (resp *CliResponse) SetVersion(v Version) {}
+
+// Merge pagination and warnings kept elsewhere into the meta of the next response
+func (resp *CliResponse) SetMeta(meta Meta) {
+	if meta.Pagination != nil {
+		resp.meta.Pagination = meta.Pagination
+	}
+	resp.meta.Warnings = append(resp.meta.Warnings, meta.Warnings...)
+}
+
+// Print warnings and the cursor of the next page on stderr, envelopes carry them in meta
+func (resp *CliResponse) printMeta() {
+	for _, warning := range resp.meta.Warnings {
+		_, _ = fmt.Fprintf(resp.C.App.ErrWriter, "warning: %s\n", warning)
+	}
+	if p := resp.meta.Pagination; p != nil && p.NextCursor != "" {
+		_, _ = fmt.Fprintf(resp.C.App.ErrWriter, "more results with --%s %s\n", CursorParam, p.NextCursor)
+	}
+}
+
+// Exit code of the command, 1 if an error status was responded
+func (resp *CliResponse) ExitCode() int {
+	if resp.code >= http.StatusBadRequest {
+		return 1
+	}
+	return 0
+}
+
+// Write content as a file to the path of --out, or to stdout if it is empty or -,
+// a directory given as path gets the file under its name
+func (resp *CliResponse) SendFile(d Download) error {
+	defer d.close()
+	resp.finishProgress()
+	out := resp.C.String("out")
+	if out == "" || out == StdinPath {
+		_, err := io.Copy(resp.C.App.Writer, d.Content)
+		resp.code = http.StatusOK
+		return err
+	}
+	if info, err := os.Stat(out); err == nil && info.IsDir() && d.Name != "" {
+		out = filepath.Join(out, filepath.Base(d.Name))
+	}
+	f, err := os.Create(out)
+	if err != nil {
+		resp.SendSimpleFail(err.Error())
+		return err
+	}
+	n, err := io.Copy(f, d.Content)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		resp.SendSimpleFail(err.Error())
+		return err
+	}
+	resp.code = http.StatusOK
+	resp.data = out
+	_, _ = fmt.Fprintf(resp.C.App.ErrWriter, "saved %s (%d bytes)\n", out, n)
+	return nil
+}
+
+// Status and data of the last response, data is nil if none was sent
+func (resp *CliResponse) Result() (int, interface{}) {
+	return resp.code, resp.data
+}
+
+// Render progress on stderr, as a live bar on a terminal and as lines otherwise
+func (resp *CliResponse) Progress(p Progress) {
+	if resp.progress == nil {
+		resp.progress = &progressBar{w: resp.C.App.ErrWriter, tty: utils.IsTerminal(resp.C.App.ErrWriter)}
+	}
+	resp.progress.render(p)
+}
+
+func (resp *CliResponse) finishProgress() {
+	if resp.progress != nil {
+		resp.progress.finish()
+	}
+}
+
+// Print one item of a stream per line, strings as is and other values as json,
+// there is no other output format, an error is returned once the command is interrupted
+func (resp *CliResponse) Send(item interface{}) error {
+	if err := resp.C.Context.Err(); err != nil {
+		return err
+	}
+	resp.finishProgress()
+	resp.code = http.StatusOK
+	if s, ok := item.(string); ok {
+		_, err := fmt.Fprintln(resp.C.App.Writer, s)
+		return err
+	}
+	return writeItemLine(resp.C.App.Writer, item)
+}
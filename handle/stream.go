@@ -0,0 +1,69 @@
+package handle
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Streaming content types of api responses
+const (
+	eventStreamType = "text/event-stream"
+	ndjsonType      = "application/x-ndjson"
+)
+
+// Pick the streaming content type accepted by the client, empty if it only takes a single body
+func streamType(c *gin.Context) string {
+	accept := c.GetHeader("Accept")
+	switch {
+	case strings.Contains(accept, eventStreamType):
+		return eventStreamType
+	case strings.Contains(accept, ndjsonType), strings.Contains(accept, "application/jsonl"):
+		return ndjsonType
+	}
+	return ""
+}
+
+// Write one server-sent event
+func writeEvent(w io.Writer, event string, data interface{}) error {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, b)
+	return err
+}
+
+// Write one json line
+func writeLine(w io.Writer, event string, data interface{}) error {
+	b, err := json.Marshal(map[string]interface{}{event: data})
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s\n", b)
+	return err
+}
+
+// Write one stream item as a server-sent event without event name, so
+// EventSource clients receive it as a message
+func writeItemEvent(w io.Writer, id int, item interface{}) error {
+	b, err := json.Marshal(item)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\ndata: %s\n\n", id, b)
+	return err
+}
+
+// Write one stream item as a json line
+func writeItemLine(w io.Writer, item interface{}) error {
+	b, err := json.Marshal(item)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s\n", b)
+	return err
+}
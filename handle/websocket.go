@@ -0,0 +1,137 @@
+package handle
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin/binding"
+	"github.com/gorilla/websocket"
+	"github.com/pkg/errors"
+)
+
+// WebSocketFunc handles a websocket connection, action holds the parameters of the upgrade request
+type WebSocketFunc func(action Action, conn Conn)
+
+// Conn exchanges typed messages over a bidirectional channel
+type Conn interface {
+	// Read the next message into v and validate it like request parameters
+	Receive(v interface{}) error
+	// Send v as a json message
+	Send(v interface{}) error
+	// Cancelled once the peer is gone
+	Context() context.Context
+	Close() error
+}
+
+// Number of received messages queued until the handler reads them
+const receiveQueueSize = 64
+
+// ErrReceiveQueueFull is returned by Receive once the peer sent more messages than were queued
+var ErrReceiveQueueFull = errors.New("too many unread messages")
+
+// WebSocketConn implements Conn on a websocket
+type WebSocketConn struct {
+	ws        *websocket.Conn
+	ctx       context.Context
+	cancel    context.CancelFunc
+	writeMu   sync.Mutex
+	writeWait time.Duration
+	// messages read by the read loop, closed once reading failed
+	messages chan []byte
+	readErr  error
+}
+
+// Create a conn on ws, ctx is cancelled when the connection closes
+//
+// The conn reads ws in the background, so control frames and read deadlines
+// are handled even if the handler never calls Receive
+func NewWebSocketConn(ctx context.Context, ws *websocket.Conn, writeWait time.Duration) *WebSocketConn {
+	ctx, cancel := context.WithCancel(ctx)
+	conn := &WebSocketConn{ws: ws, ctx: ctx, cancel: cancel, writeWait: writeWait, messages: make(chan []byte, receiveQueueSize)}
+	// the close is answered by Close, so replies to queued messages still reach the peer
+	ws.SetCloseHandler(func(int, string) error { return nil })
+	go conn.readLoop()
+	return conn
+}
+
+// Read messages until the connection fails
+//
+// Reading goes on while the handler is busy so control frames are answered,
+// a peer filling the queue is disconnected with a policy violation instead
+// of losing messages
+func (conn *WebSocketConn) readLoop() {
+	defer close(conn.messages)
+	for {
+		_, data, err := conn.ws.ReadMessage()
+		if err != nil {
+			conn.readErr = err
+			conn.cancel()
+			return
+		}
+		select {
+		case conn.messages <- data:
+		default:
+			conn.readErr = ErrReceiveQueueFull
+			conn.cancel()
+			conn.writeMu.Lock()
+			_ = conn.ws.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.ClosePolicyViolation, ErrReceiveQueueFull.Error()), time.Now().Add(conn.writeWait))
+			conn.writeMu.Unlock()
+			return
+		}
+	}
+}
+
+// Read the next message into v and validate it with the binding tags
+//
+// Up to 64 messages are queued while the handler does not receive, the
+// connection is closed with ErrReceiveQueueFull when the peer sends more
+func (conn *WebSocketConn) Receive(v interface{}) error {
+	data, ok := <-conn.messages
+	if !ok {
+		return conn.readErr
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return err
+	}
+	if binding.Validator == nil {
+		return nil
+	}
+	return binding.Validator.ValidateStruct(v)
+}
+
+// Send v as a json text message
+func (conn *WebSocketConn) Send(v interface{}) error {
+	conn.writeMu.Lock()
+	defer conn.writeMu.Unlock()
+	_ = conn.ws.SetWriteDeadline(time.Now().Add(conn.writeWait))
+	if err := conn.ws.WriteJSON(v); err != nil {
+		conn.cancel()
+		return err
+	}
+	return nil
+}
+
+// Send a ping, used for keepalive
+func (conn *WebSocketConn) Ping() error {
+	conn.writeMu.Lock()
+	defer conn.writeMu.Unlock()
+	return conn.ws.WriteControl(websocket.PingMessage, nil, time.Now().Add(conn.writeWait))
+}
+
+// Context of the connection
+func (conn *WebSocketConn) Context() context.Context {
+	return conn.ctx
+}
+
+// Close the connection with a normal closure
+func (conn *WebSocketConn) Close() error {
+	conn.cancel()
+	conn.writeMu.Lock()
+	_ = conn.ws.WriteControl(websocket.CloseMessage,
+		websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(conn.writeWait))
+	conn.writeMu.Unlock()
+	return conn.ws.Close()
+}
@@ -0,0 +1,167 @@
+package jobs
+
+import (
+	"crypto/subtle"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/zfs123/go-ac-router/auth"
+	"github.com/zfs123/go-ac-router/handle"
+)
+
+// Status of a job
+type Status string
+
+const (
+	StatusPending   Status = "pending"
+	StatusRunning   Status = "running"
+	StatusSucceeded Status = "succeeded"
+	StatusFailed    Status = "failed"
+	StatusCancelled Status = "cancelled"
+)
+
+// Check whether the job will not change anymore
+func (s Status) Finished() bool {
+	return s == StatusSucceeded || s == StatusFailed || s == StatusCancelled
+}
+
+// ErrNotFound is returned for unknown job ids
+var ErrNotFound = errors.New("job not found")
+
+// Job is a handler invocation running in the background
+type Job struct {
+	ID         string           `json:"id"`
+	Route      string           `json:"route"`
+	Status     Status           `json:"status"`
+	Code       int              `json:"code,omitempty"`
+	Result     interface{}      `json:"result,omitempty"`
+	Error      string           `json:"error,omitempty"`
+	Progress   *handle.Progress `json:"progress,omitempty"`
+	Meta       *handle.Meta     `json:"meta,omitempty"`
+	RequestID  string           `json:"request_id,omitempty"`
+	CreatedAt  time.Time        `json:"created_at"`
+	StartedAt  *time.Time       `json:"started_at,omitempty"`
+	FinishedAt *time.Time       `json:"finished_at,omitempty"`
+	// the job is removed from the store after this time, it is set once the job finished
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	// Principal that started the job, nil if it was started anonymously
+	Principal *auth.Principal `json:"principal,omitempty"`
+	// Secret proving ownership of jobs started anonymously
+	Token string `json:"token,omitempty"`
+	// Parameters of the request that started the job, kept to authorize reads of the result
+	Params url.Values `json:"-"`
+}
+
+// Check whether the job expired at now
+func (job *Job) Expired(now time.Time) bool {
+	return job.ExpiresAt != nil && now.After(*job.ExpiresAt)
+}
+
+// Check whether p started the job, anonymous jobs are only owned by the holder of their token
+func (job *Job) OwnedBy(p *auth.Principal) bool {
+	if job.Principal == nil || p == nil {
+		return false
+	}
+	return job.Principal.Name == p.Name && job.Principal.Method == p.Method
+}
+
+// Check whether token is the token of an anonymous job
+func (job *Job) HasToken(token string) bool {
+	return job.Token != "" && subtle.ConstantTimeCompare([]byte(job.Token), []byte(token)) == 1
+}
+
+// Store keeps jobs, implementations backed by a shared store let
+// other processes see the jobs
+type Store interface {
+	Create(job *Job) error
+	Get(id string) (*Job, error)
+	Update(job *Job) error
+	List() ([]*Job, error)
+	Delete(id string) error
+}
+
+// MemoryStore keeps jobs in process memory
+type MemoryStore struct {
+	mu   sync.RWMutex
+	jobs map[string]*Job
+}
+
+// Create an in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{jobs: map[string]*Job{}}
+}
+
+// Save a new job, expired jobs are removed on the way
+func (s *MemoryStore) Create(job *Job) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	for id, saved := range s.jobs {
+		if saved.Expired(now) {
+			delete(s.jobs, id)
+		}
+	}
+	if _, ok := s.jobs[job.ID]; ok {
+		return errors.Errorf("job %s already exists", job.ID)
+	}
+	cp := *job
+	s.jobs[job.ID] = &cp
+	return nil
+}
+
+// Get a copy of the job
+func (s *MemoryStore) Get(id string) (*Job, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	job, ok := s.jobs[id]
+	if !ok || job.Expired(time.Now()) {
+		return nil, ErrNotFound
+	}
+	cp := *job
+	return &cp, nil
+}
+
+// Replace the saved job
+func (s *MemoryStore) Update(job *Job) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.jobs[job.ID]; !ok {
+		return ErrNotFound
+	}
+	cp := *job
+	s.jobs[job.ID] = &cp
+	return nil
+}
+
+// List copies of all jobs that did not expire, oldest first
+func (s *MemoryStore) List() ([]*Job, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	now := time.Now()
+	list := make([]*Job, 0, len(s.jobs))
+	for _, job := range s.jobs {
+		if job.Expired(now) {
+			continue
+		}
+		cp := *job
+		list = append(list, &cp)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].CreatedAt.Before(list[j].CreatedAt)
+	})
+	return list, nil
+}
+
+// Remove the job
+func (s *MemoryStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.jobs[id]; !ok {
+		return ErrNotFound
+	}
+	delete(s.jobs, id)
+	return nil
+}
@@ -0,0 +1,174 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/zfs123/go-ac-router/auth"
+	"github.com/zfs123/go-ac-router/utils"
+)
+
+// Manager runs jobs in the background and tracks their cancellation
+type Manager struct {
+	store Store
+	// how long finished jobs are kept, forever if zero
+	ttl     time.Duration
+	mu      sync.Mutex
+	cancels map[string]context.CancelFunc
+	wg      sync.WaitGroup
+}
+
+// Create a manager keeping jobs in store, finished jobs expire after ttl unless it is zero
+func NewManager(store Store, ttl time.Duration) *Manager {
+	return &Manager{store: store, ttl: ttl, cancels: map[string]context.CancelFunc{}}
+}
+
+// Get the store of the manager
+func (m *Manager) Store() Store {
+	return m.store
+}
+
+// Start run in the background, ctx only provides values, its cancellation is ignored
+//
+// The job belongs to the principal of ctx, jobs started anonymously get a token
+// proving ownership instead. params are the request parameters of the job
+func (m *Manager) Start(ctx context.Context, route, requestID string, params url.Values, run func(ctx context.Context, response *Response)) (*Job, error) {
+	job := &Job{
+		ID:        utils.RandomHex(8),
+		Route:     route,
+		Status:    StatusPending,
+		RequestID: requestID,
+		CreatedAt: time.Now(),
+		Principal: auth.PrincipalFromContext(ctx),
+		Params:    params,
+	}
+	if job.Principal == nil {
+		job.Token = utils.RandomHex(16)
+	}
+	if err := m.store.Create(job); err != nil {
+		return nil, err
+	}
+	jobCtx, cancel := context.WithCancel(utils.Detach(ctx))
+	m.mu.Lock()
+	m.cancels[job.ID] = cancel
+	m.mu.Unlock()
+
+	m.wg.Add(1)
+	go m.run(jobCtx, job.ID, run)
+	return job, nil
+}
+
+func (m *Manager) run(ctx context.Context, id string, run func(ctx context.Context, response *Response)) {
+	defer m.wg.Done()
+	defer func() {
+		m.mu.Lock()
+		cancel := m.cancels[id]
+		delete(m.cancels, id)
+		m.mu.Unlock()
+		cancel()
+	}()
+
+	now := time.Now()
+	m.update(id, func(job *Job) {
+		job.Status = StatusRunning
+		job.StartedAt = &now
+	})
+
+	response := &Response{manager: m, id: id}
+	func() {
+		defer func() {
+			if p := recover(); p != nil {
+				response.fail(fmt.Sprint("panic: ", p))
+			}
+		}()
+		run(ctx, response)
+	}()
+
+	finished := time.Now()
+	m.update(id, func(job *Job) {
+		job.FinishedAt = &finished
+		if m.ttl > 0 {
+			expires := finished.Add(m.ttl)
+			job.ExpiresAt = &expires
+		}
+		switch {
+		case ctx.Err() == context.Canceled:
+			job.Status = StatusCancelled
+		case job.Code >= 400 || job.Error != "":
+			job.Status = StatusFailed
+		default:
+			job.Status = StatusSucceeded
+		}
+	})
+}
+
+// Apply f to the stored job
+func (m *Manager) update(id string, f func(job *Job)) {
+	job, err := m.store.Get(id)
+	if err != nil {
+		return
+	}
+	f(job)
+	_ = m.store.Update(job)
+}
+
+// Cancel a running job, finished jobs are left untouched
+func (m *Manager) Cancel(id string) error {
+	job, err := m.store.Get(id)
+	if err != nil {
+		return err
+	}
+	if job.Status.Finished() {
+		return nil
+	}
+	m.mu.Lock()
+	cancel, ok := m.cancels[id]
+	m.mu.Unlock()
+	if !ok {
+		// the job runs in another process sharing the store
+		return fmt.Errorf("job %s is not running in this process", id)
+	}
+	cancel()
+	return nil
+}
+
+// Wait until all jobs of this process finished
+func (m *Manager) Wait() {
+	m.wg.Wait()
+}
+
+// Poll the job every interval until it finished, onChange is called with every new state
+func (m *Manager) Follow(ctx context.Context, id string, interval time.Duration, onChange func(job *Job)) (*Job, error) {
+	var last *Job
+	for {
+		job, err := m.store.Get(id)
+		if err != nil {
+			return nil, err
+		}
+		if onChange != nil && (last == nil || changed(last, job)) {
+			onChange(job)
+		}
+		last = job
+		if job.Status.Finished() {
+			return job, nil
+		}
+		select {
+		case <-ctx.Done():
+			return job, ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+}
+
+func changed(a, b *Job) bool {
+	if a.Status != b.Status {
+		return true
+	}
+	if a.Progress == nil || b.Progress == nil {
+		return a.Progress != b.Progress
+	}
+	return *a.Progress != *b.Progress
+}
@@ -0,0 +1,98 @@
+package jobs
+
+import (
+	"io"
+	"net/http"
+
+	"github.com/pkg/errors"
+
+	"github.com/zfs123/go-ac-router/handle"
+)
+
+// Response stores the output of a handler as the result of its job
+type Response struct {
+	manager *Manager
+	id      string
+}
+
+// Store data as job result
+func (resp *Response) Response(code int, data interface{}) {
+	resp.manager.update(resp.id, func(job *Job) {
+		job.Code = code
+		job.Result = data
+	})
+}
+
+// Simple send success
+func (resp *Response) SendSimpleOk(msg string) {
+	resp.Response(http.StatusOK, map[string]interface{}{"code": 0, "msg": msg})
+}
+
+// Simple send error
+func (resp *Response) SendSimpleFail(msg string) {
+	resp.Response(http.StatusInternalServerError, map[string]interface{}{"code": 1, "msg": msg})
+	resp.fail(msg)
+}
+
+// Store progress in the job status
+func (resp *Response) Progress(p handle.Progress) {
+	resp.manager.update(resp.id, func(job *Job) {
+		job.Progress = &p
+	})
+}
+
+// Append item to the job result, which becomes a list of all items
+func (resp *Response) Send(item interface{}) error {
+	resp.manager.update(resp.id, func(job *Job) {
+		items, _ := job.Result.([]interface{})
+		job.Code = http.StatusOK
+		job.Result = append(items, item)
+	})
+	return nil
+}
+
+// Files are not kept in the job store, the job fails instead
+func (resp *Response) SendFile(d handle.Download) error {
+	if closer, ok := d.Content.(io.Closer); ok {
+		_ = closer.Close()
+	}
+	resp.SendSimpleFail("files can not be sent from a background job")
+	return errors.New("files can not be sent from a background job")
+}
+
+// Keep the page in the job meta, it is sent along the result
+func (resp *Response) SetPage(p *handle.Page) {
+	resp.manager.update(resp.id, func(job *Job) {
+		meta := job.copyMeta()
+		meta.Pagination = p.Pagination()
+		job.Meta = meta
+	})
+}
+
+// Keep the warning in the job meta, it is sent along the result
+func (resp *Response) Warn(msg string) {
+	resp.manager.update(resp.id, func(job *Job) {
+		meta := job.copyMeta()
+		meta.Warnings = append(meta.Warnings, msg)
+		job.Meta = meta
+	})
+}
+
+// Results of jobs are read from the job routes, versions of them are not kept
+func (resp *Response) SetVersion(v handle.Version) {}
+
+// Copy of the job meta, stores share it with the copies they hand out
+func (job *Job) copyMeta() *handle.Meta {
+	meta := &handle.Meta{}
+	if job.Meta != nil {
+		*meta = *job.Meta
+		meta.Warnings = append([]string(nil), job.Meta.Warnings...)
+	}
+	return meta
+}
+
+func (resp *Response) fail(msg string) {
+	resp.manager.update(resp.id, func(job *Job) {
+		job.Error = msg
+	})
+}
@@ -0,0 +1,159 @@
+package jsonrpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+)
+
+// Version is the only protocol version supported
+const Version = "2.0"
+
+// Standard error codes
+const (
+	CodeParseError     = -32700
+	CodeInvalidRequest = -32600
+	CodeMethodNotFound = -32601
+	CodeInvalidParams  = -32602
+	CodeInternalError  = -32603
+	// CodeServerError is the start of the range reserved for implementation defined errors
+	CodeServerError = -32000
+)
+
+// Request is a single call or notification
+type Request struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	// ID is nil for notifications
+	ID json.RawMessage `json:"id,omitempty"`
+}
+
+// Check whether the request expects no response
+func (req *Request) IsNotification() bool {
+	return req.ID == nil
+}
+
+// Error is the error object of a response
+type Error struct {
+	Code    int         `json:"code"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Create an error
+func NewError(code int, message string, data interface{}) *Error {
+	return &Error{Code: code, Message: message, Data: data}
+}
+
+// Response is the answer to a call
+type Response struct {
+	Result interface{}
+	Error  *Error
+	ID     json.RawMessage
+}
+
+// Encode the response, result is always present on success even if null
+func (resp Response) MarshalJSON() ([]byte, error) {
+	id := resp.ID
+	if id == nil {
+		id = json.RawMessage("null")
+	}
+	if resp.Error != nil {
+		return json.Marshal(struct {
+			JSONRPC string          `json:"jsonrpc"`
+			Error   *Error          `json:"error"`
+			ID      json.RawMessage `json:"id"`
+		}{Version, resp.Error, id})
+	}
+	return json.Marshal(struct {
+		JSONRPC string          `json:"jsonrpc"`
+		Result  interface{}     `json:"result"`
+		ID      json.RawMessage `json:"id"`
+	}{Version, resp.Result, id})
+}
+
+// Handler executes a method, params is nil if the request has none
+type Handler func(ctx context.Context, method string, params json.RawMessage) (interface{}, *Error)
+
+// Handle a single request or a batch, nil is returned if nothing needs to be sent back
+func Handle(ctx context.Context, body []byte, handler Handler) []byte {
+	body = bytes.TrimSpace(body)
+	if len(body) > 0 && body[0] == '[' {
+		var batch []json.RawMessage
+		if err := json.Unmarshal(body, &batch); err != nil {
+			return encode(Response{Error: NewError(CodeParseError, "parse error", nil)})
+		}
+		if len(batch) == 0 {
+			return encode(Response{Error: NewError(CodeInvalidRequest, "invalid request", "empty batch")})
+		}
+		var responses []Response
+		for _, raw := range batch {
+			if resp, ok := call(ctx, raw, handler); ok {
+				responses = append(responses, resp)
+			}
+		}
+		if len(responses) == 0 {
+			return nil
+		}
+		return encode(responses)
+	}
+	if resp, ok := call(ctx, body, handler); ok {
+		return encode(resp)
+	}
+	return nil
+}
+
+// Execute one request, ok is false for notifications
+func call(ctx context.Context, raw json.RawMessage, handler Handler) (Response, bool) {
+	var req Request
+	if err := json.Unmarshal(raw, &req); err != nil {
+		if _, syntax := err.(*json.SyntaxError); syntax {
+			return Response{Error: NewError(CodeParseError, "parse error", nil)}, true
+		}
+		return Response{Error: NewError(CodeInvalidRequest, "invalid request", nil)}, true
+	}
+	if req.JSONRPC != Version || req.Method == "" || !validID(req.ID) {
+		return Response{Error: NewError(CodeInvalidRequest, "invalid request", nil), ID: validIDOrNil(req.ID)}, true
+	}
+	result, rpcErr := handler(ctx, req.Method, req.Params)
+	if req.IsNotification() {
+		return Response{}, false
+	}
+	return Response{Result: result, Error: rpcErr, ID: req.ID}, true
+}
+
+// An id must be a string, a number or null
+func validID(id json.RawMessage) bool {
+	if id == nil {
+		return true
+	}
+	var v interface{}
+	if err := json.Unmarshal(id, &v); err != nil {
+		return false
+	}
+	switch v.(type) {
+	case nil, string, float64:
+		return true
+	}
+	return false
+}
+
+func validIDOrNil(id json.RawMessage) json.RawMessage {
+	if validID(id) {
+		return id
+	}
+	return nil
+}
+
+func encode(v interface{}) []byte {
+	b, err := json.Marshal(v)
+	if err != nil {
+		b, _ = json.Marshal(Response{Error: NewError(CodeInternalError, "internal error", err.Error())})
+	}
+	return b
+}
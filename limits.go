@@ -0,0 +1,291 @@
+package acrouter
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/zfs123/go-ac-router/handle"
+)
+
+// Handle the route with a timeout, the router default is used if zero
+func Timeout(d time.Duration) RouteOption {
+	return func(route *Route) {
+		route.Timeout = d
+	}
+}
+
+// Limit the request body of the route to n bytes, the router default is used if zero
+func MaxBodyBytes(n int64) RouteOption {
+	return func(route *Route) {
+		route.MaxBodyBytes = n
+	}
+}
+
+// Keep up to n bytes of multipart forms of the route in memory, the rest goes to temporary files
+func MaxMultipartMemory(n int64) RouteOption {
+	return func(route *Route) {
+		route.MaxMultipartMemory = n
+	}
+}
+
+// limitedBody fails with handle.ErrBodyTooLarge once more than its limit is read
+type limitedBody struct {
+	io.ReadCloser
+	remaining int64
+	exceeded  bool
+}
+
+func (lb *limitedBody) Read(p []byte) (int, error) {
+	if lb.exceeded {
+		return 0, handle.ErrBodyTooLarge
+	}
+	// read one byte more than allowed to tell a body of exactly the limit from a larger one
+	if int64(len(p)) > lb.remaining+1 {
+		p = p[:lb.remaining+1]
+	}
+	n, err := lb.ReadCloser.Read(p)
+	if int64(n) > lb.remaining {
+		n = int(lb.remaining)
+		lb.remaining = 0
+		lb.exceeded = true
+		return n, handle.ErrBodyTooLarge
+	}
+	lb.remaining -= int64(n)
+	return n, err
+}
+
+// Reject request bodies larger than max with 413
+//
+// Errors answered after the limit was hit are replaced by the 413
+func bodyLimitMiddleware(max int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.ContentLength > max {
+			abortWithError(c, http.StatusRequestEntityTooLarge, handle.ErrBodyTooLarge.Error())
+			return
+		}
+		body := &limitedBody{ReadCloser: c.Request.Body, remaining: max}
+		c.Request.Body = body
+		c.Request = c.Request.WithContext(handle.ContextWithBodyLimit(c.Request.Context(), func() bool {
+			return body.exceeded
+		}))
+		c.Next()
+		if body.exceeded && !c.Writer.Written() {
+			abortWithError(c, http.StatusRequestEntityTooLarge, handle.ErrBodyTooLarge.Error())
+		}
+	}
+}
+
+// Parse multipart forms with the memory limit of the route before gin does
+func multipartMemoryMiddleware(max int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if strings.HasPrefix(c.ContentType(), "multipart/form-data") {
+			if err := c.Request.ParseMultipartForm(max); err != nil && err != http.ErrNotMultipart {
+				abortWithError(c, http.StatusBadRequest, "invalid multipart form")
+				return
+			}
+		}
+		c.Next()
+	}
+}
+
+// Cancel the context of the rest of the chain after d and answer 503
+//
+// The handler keeps running until it returns, its output after the timeout is
+// discarded. Handlers should watch the request context to stop early.
+// Streams are sent as they are flushed and disarm the timeout.
+func timeoutMiddleware(d time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithCancel(c.Request.Context())
+		defer cancel()
+		timer := time.NewTimer(d)
+		defer timer.Stop()
+		// built before the chain runs, which owns c.Request afterwards
+		timeoutBody := handle.ErrorBody(ctx, http.StatusServiceUnavailable, "handler timeout")
+		c.Request = c.Request.WithContext(ctx)
+
+		original := c.Writer
+		tw := &timeoutWriter{ResponseWriter: original, header: http.Header{}, timer: timer}
+		for k, v := range original.Header() {
+			tw.header[k] = v
+		}
+		c.Writer = tw
+
+		done := make(chan struct{})
+		var panicked interface{}
+		go func() {
+			defer close(done)
+			defer func() {
+				panicked = recover()
+			}()
+			c.Next()
+		}()
+
+		select {
+		case <-done:
+			c.Writer = original
+			if panicked != nil {
+				panic(panicked)
+			}
+			tw.flushTo(original)
+		case <-timer.C:
+			if !tw.expire() {
+				// a stream started just as the timer fired
+				<-done
+				c.Writer = original
+				return
+			}
+			cancel()
+			// the chain still owns the gin context, so answer on the raw writer
+			body, _ := json.Marshal(timeoutBody)
+			original.Header().Set("Content-Type", "application/json; charset=utf-8")
+			original.WriteHeader(http.StatusServiceUnavailable)
+			_, _ = original.Write(body)
+			original.Flush()
+			// the gin context is recycled once this returns, so wait for the handler
+			<-done
+			c.Writer = original
+			c.Abort()
+		}
+	}
+}
+
+// timeoutWriter buffers the response until the handler finished in time
+type timeoutWriter struct {
+	gin.ResponseWriter
+	mu          sync.Mutex
+	header      http.Header
+	buf         bytes.Buffer
+	code        int
+	wroteHeader bool
+	timedOut    bool
+	// the response was committed by a flush and is written through
+	streaming bool
+	timer     *time.Timer
+}
+
+func (tw *timeoutWriter) Header() http.Header {
+	return tw.header
+}
+
+func (tw *timeoutWriter) WriteHeader(code int) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut || tw.wroteHeader {
+		return
+	}
+	tw.code = code
+}
+
+func (tw *timeoutWriter) WriteHeaderNow() {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	tw.writeHeaderLocked()
+}
+
+func (tw *timeoutWriter) writeHeaderLocked() {
+	if tw.wroteHeader {
+		return
+	}
+	if tw.code == 0 {
+		tw.code = http.StatusOK
+	}
+	tw.wroteHeader = true
+}
+
+func (tw *timeoutWriter) Write(b []byte) (int, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	if tw.streaming {
+		return tw.ResponseWriter.Write(b)
+	}
+	tw.writeHeaderLocked()
+	return tw.buf.Write(b)
+}
+
+func (tw *timeoutWriter) WriteString(s string) (int, error) {
+	return tw.Write([]byte(s))
+}
+
+func (tw *timeoutWriter) Status() int {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.code == 0 {
+		return http.StatusOK
+	}
+	return tw.code
+}
+
+func (tw *timeoutWriter) Size() int {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if !tw.wroteHeader {
+		return -1
+	}
+	return tw.buf.Len()
+}
+
+func (tw *timeoutWriter) Written() bool {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	return tw.wroteHeader
+}
+
+// Commit the response so far and write the rest through, the timeout no longer applies
+func (tw *timeoutWriter) Flush() {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut {
+		return
+	}
+	if !tw.streaming {
+		tw.timer.Stop()
+		tw.writeHeaderLocked()
+		tw.commit(tw.ResponseWriter)
+		tw.streaming = true
+	}
+	tw.ResponseWriter.Flush()
+}
+
+// Mark the response as timed out, false if it is streaming already
+func (tw *timeoutWriter) expire() bool {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.streaming {
+		return false
+	}
+	tw.timedOut = true
+	return true
+}
+
+// Copy the buffered response to w
+func (tw *timeoutWriter) flushTo(w gin.ResponseWriter) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if !tw.streaming {
+		tw.commit(w)
+	}
+}
+
+func (tw *timeoutWriter) commit(w gin.ResponseWriter) {
+	dst := w.Header()
+	for k, v := range tw.header {
+		dst[k] = v
+	}
+	if tw.code != 0 {
+		w.WriteHeader(tw.code)
+	}
+	if tw.wroteHeader {
+		w.WriteHeaderNow()
+		_, _ = w.Write(tw.buf.Bytes())
+	}
+}
@@ -0,0 +1,88 @@
+package acrouter
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zfs123/go-ac-router/handle"
+)
+
+func TestMaxBodyBytes(t *testing.T) {
+	r, err := New(RequestLimits(http.DefaultMaxHeaderBytes, 8))
+	if err != nil {
+		t.Fatal(err)
+	}
+	echo := func(action handle.Action, response handle.Response) {
+		b, err := ioutil.ReadAll(action.(*handle.ApiAction).C.Request.Body)
+		if err != nil {
+			return
+		}
+		response.Response(http.StatusOK, string(b))
+	}
+	r.AddApiRoute("/echo", "POST", "echo api", nil, nil, echo)
+	r.AddApiRoute("/upload", "POST", "upload api", nil, nil, echo, MaxBodyBytes(64))
+	r.AddApiRoute("/bind", "POST", "bind api", nil, nil, func(action handle.Action, response handle.Response) {
+		var v map[string]interface{}
+		if err := action.(*handle.ApiAction).C.ShouldBindJSON(&v); err != nil {
+			// the handler answers the error itself
+			response.Response(http.StatusBadRequest, err.Error())
+			return
+		}
+		response.Response(http.StatusOK, v)
+	})
+
+	send := func(path, body string, chunked bool) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", path, strings.NewReader(body))
+		if chunked {
+			req.ContentLength = -1
+		}
+		w := httptest.NewRecorder()
+		r.api.Engine.ServeHTTP(w, req)
+		return w
+	}
+	assert.Equal(t, http.StatusOK, send("/echo", "short", false).Code)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, send("/echo", "much too long", false).Code)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, send("/echo", "much too long", true).Code)
+	assert.Equal(t, http.StatusOK, send("/upload", "much too long", false).Code)
+	assert.Equal(t, http.StatusOK, send("/echo", "12345678", true).Code)
+	assert.Equal(t, http.StatusOK, send("/bind", `{"a":1}`, true).Code)
+	w := send("/bind", `{"a":"much too long"}`, true)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+	assert.Contains(t, w.Body.String(), `"msg":"request body too large"`)
+	assert.Equal(t, http.StatusBadRequest, send("/bind", `{"a"`, true).Code)
+}
+
+func TestHandlerTimeout(t *testing.T) {
+	r, err := New(HandlerTimeout(time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cancelled := make(chan bool, 1)
+	r.AddApiRoute("/slow", "GET", "slow api", nil, nil, func(action handle.Action, response handle.Response) {
+		select {
+		case <-action.(*handle.ApiAction).C.Request.Context().Done():
+			cancelled <- true
+		case <-time.After(5 * time.Second):
+			cancelled <- false
+		}
+		response.SendSimpleOk("too late")
+	}, Timeout(20*time.Millisecond))
+	r.AddApiRoute("/fast", "GET", "fast api", nil, nil, func(action handle.Action, response handle.Response) {
+		response.Response(http.StatusCreated, "done")
+	})
+
+	w := performRequest(r, "GET", "/slow")
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Contains(t, w.Body.String(), `"msg":"handler timeout"`)
+	assert.True(t, <-cancelled)
+
+	w = performRequest(r, "GET", "/fast")
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, `"done"`, w.Body.String())
+	assert.NotEmpty(t, w.Header().Get("X-Request-ID"))
+}
@@ -7,7 +7,7 @@ import (
 )
 
 var (
-	logger      *zap.Logger
+	logger      = zap.NewNop()
 	atomicLevel zap.AtomicLevel
 )
 
@@ -0,0 +1,24 @@
+package logger
+
+import (
+	"github.com/zfs123/go-ac-router/trace"
+	"go.uber.org/zap"
+)
+
+// Fields identifying the span sc in log entries
+func TraceFields(sc trace.SpanContext) []zap.Field {
+	if !sc.IsValid() {
+		return nil
+	}
+	return []zap.Field{
+		zap.String("trace_id", sc.TraceID.String()),
+		zap.String("span_id", sc.SpanID.String()),
+	}
+}
+
+// WithTrace creates a child logger adding the trace and span id of sc
+//
+// The package logger skips the frame of the helpers, callers of the child log directly
+func WithTrace(sc trace.SpanContext) *zap.Logger {
+	return logger.WithOptions(zap.AddCallerSkip(-1)).With(TraceFields(sc)...)
+}
@@ -0,0 +1,135 @@
+package acrouter
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+	"github.com/zfs123/go-ac-router/logger"
+	"github.com/zfs123/go-ac-router/metrics"
+	"go.uber.org/zap"
+)
+
+// routerMetrics instruments api routes, cli commands are written to textfiles
+// by writeCommandTextfile as their process is gone before a scrape
+type routerMetrics struct {
+	registry         *metrics.Registry
+	httpRequests     *metrics.CounterVec
+	httpDuration     *metrics.HistogramVec
+	httpInFlight     *metrics.GaugeVec
+	httpResponseSize *metrics.HistogramVec
+	rateLimited      *metrics.CounterVec
+	concurrency      *metrics.GaugeVec
+}
+
+func newRouterMetrics(registry *metrics.Registry) *routerMetrics {
+	return &routerMetrics{
+		registry: registry,
+		httpRequests: registry.NewCounterVec("acrouter_http_requests_total",
+			"Total number of http requests.", "method", "route", "code"),
+		httpDuration: registry.NewHistogramVec("acrouter_http_request_duration_seconds",
+			"Latency of http requests in seconds.", metrics.DefaultBuckets, "method", "route"),
+		httpInFlight: registry.NewGaugeVec("acrouter_http_requests_in_flight",
+			"Number of http requests currently being served.", "method", "route"),
+		httpResponseSize: registry.NewHistogramVec("acrouter_http_response_size_bytes",
+			"Size of http responses in bytes.", metrics.SizeBuckets, "method", "route"),
+		rateLimited: registry.NewCounterVec("acrouter_rate_limited_total",
+			"Total number of requests rejected by a limiter.", "route", "limiter"),
+		concurrency: registry.NewGaugeVec("acrouter_route_concurrency",
+			"Number of concurrency slots of a route currently taken.", "route"),
+	}
+}
+
+// Record request count, latency, in-flight requests and response size
+func (m *routerMetrics) middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		method := c.Request.Method
+		start := time.Now()
+		m.httpInFlight.Inc(method, route)
+		defer m.httpInFlight.Dec(method, route)
+
+		c.Next()
+
+		size := c.Writer.Size()
+		if size < 0 {
+			size = 0
+		}
+		m.httpRequests.Inc(method, route, strconv.Itoa(c.Writer.Status()))
+		m.httpDuration.Observe(time.Since(start).Seconds(), method, route)
+		m.httpResponseSize.Observe(float64(size), method, route)
+	}
+}
+
+// Record a finished cli command in the textfile of dir, failures are only logged
+func observeCommand(dir, command string, exitCode int, d time.Duration) {
+	if err := writeCommandTextfile(dir, command, exitCode, time.Now(), d); err != nil {
+		logger.Warn("write metrics textfile failed", zap.String("command", command), zap.Error(err))
+	}
+}
+
+// Write the last run of command to a node exporter textfile in dir, one file
+// per command replaced atomically, so the collector never reads a partial file
+func writeCommandTextfile(dir, command string, exitCode int, finished time.Time, d time.Duration) error {
+	registry := metrics.NewRegistry()
+	registry.NewGaugeVec("acrouter_cli_last_run_timestamp_seconds",
+		"Unix time the cli command last finished.", "command").Set(float64(finished.UnixNano())/1e9, command)
+	registry.NewGaugeVec("acrouter_cli_last_run_duration_seconds",
+		"Duration of the last run of the cli command in seconds.", "command").Set(d.Seconds(), command)
+	registry.NewGaugeVec("acrouter_cli_last_run_exit_code",
+		"Exit code of the last run of the cli command.", "command").Set(float64(exitCode), command)
+
+	name := "acrouter_cli_" + textfileName(command) + ".prom"
+	// the collector only reads *.prom files, so the temporary file is ignored
+	f, err := ioutil.TempFile(dir, "."+name+".")
+	if err != nil {
+		return errors.Wrap(err, "create metrics textfile")
+	}
+	defer os.Remove(f.Name())
+	err = registry.WriteText(f)
+	if err == nil {
+		// the collector usually runs as another user
+		err = f.Chmod(0644)
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return errors.Wrap(err, "write metrics textfile")
+	}
+	return errors.Wrap(os.Rename(f.Name(), filepath.Join(dir, name)), "write metrics textfile")
+}
+
+// Replace the characters of command not allowed in a file name by "_"
+func textfileName(command string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == '-' {
+			return r
+		}
+		return '_'
+	}, command)
+}
+
+// Expose the registry in the prometheus text exposition format
+func (m *routerMetrics) handler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Status(200)
+		c.Header("Content-Type", metrics.ContentType)
+		if err := m.registry.WriteText(c.Writer); err != nil {
+			_ = c.Error(err)
+		}
+	}
+}
+
+// Get the metrics registry, custom metrics can be registered on it
+func (r *Router) Metrics() *metrics.Registry {
+	return r.metrics.registry
+}
@@ -0,0 +1,350 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ContentType is the content type of the prometheus text exposition format
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// DefaultBuckets are the default histogram buckets, in seconds
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// SizeBuckets are histogram buckets suitable for byte sizes
+var SizeBuckets = []float64{100, 1000, 10000, 100000, 1000000, 10000000}
+
+// collector is implemented by every metric vector kept in a registry
+type collector interface {
+	write(w io.Writer) error
+}
+
+// Registry holds metrics and renders them in the prometheus text format
+type Registry struct {
+	mu         sync.Mutex
+	names      map[string]bool
+	collectors []collector
+}
+
+// Create an empty registry
+func NewRegistry() *Registry {
+	return &Registry{names: map[string]bool{}}
+}
+
+func (r *Registry) register(name string, c collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.names[name] {
+		panic(fmt.Sprintf("metrics: duplicate metric %q", name))
+	}
+	r.names[name] = true
+	r.collectors = append(r.collectors, c)
+}
+
+// Write all registered metrics in the prometheus text exposition format
+func (r *Registry) WriteText(w io.Writer) error {
+	r.mu.Lock()
+	collectors := make([]collector, len(r.collectors))
+	copy(collectors, r.collectors)
+	r.mu.Unlock()
+	for _, c := range collectors {
+		if err := c.write(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// desc is the common part of all metric vectors
+type desc struct {
+	name   string
+	help   string
+	kind   string
+	labels []string
+}
+
+func (d *desc) key(values []string) string {
+	if len(values) != len(d.labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", d.name, len(d.labels), len(values)))
+	}
+	return strings.Join(values, "\xff")
+}
+
+func (d *desc) header(w io.Writer) error {
+	_, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", d.name, escapeHelp(d.help), d.name, d.kind)
+	return err
+}
+
+// Format labels as {a="1",b="2"}, extra is appended as is
+func (d *desc) labelString(values []string, extra string) string {
+	pairs := make([]string, 0, len(values)+1)
+	for i, v := range values {
+		pairs = append(pairs, d.labels[i]+`="`+escapeLabel(v)+`"`)
+	}
+	if extra != "" {
+		pairs = append(pairs, extra)
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// value is a single float sample
+type value struct {
+	labels []string
+	v      float64
+}
+
+// valueVec is shared by counters and gauges
+type valueVec struct {
+	desc
+	mu     sync.Mutex
+	values map[string]*value
+}
+
+func (vv *valueVec) add(delta float64, labels []string) {
+	k := vv.key(labels)
+	vv.mu.Lock()
+	defer vv.mu.Unlock()
+	s, ok := vv.values[k]
+	if !ok {
+		s = &value{labels: append([]string(nil), labels...)}
+		vv.values[k] = s
+	}
+	s.v += delta
+}
+
+func (vv *valueVec) set(v float64, labels []string) {
+	k := vv.key(labels)
+	vv.mu.Lock()
+	defer vv.mu.Unlock()
+	s, ok := vv.values[k]
+	if !ok {
+		s = &value{labels: append([]string(nil), labels...)}
+		vv.values[k] = s
+	}
+	s.v = v
+}
+
+func (vv *valueVec) get(labels []string) float64 {
+	k := vv.key(labels)
+	vv.mu.Lock()
+	defer vv.mu.Unlock()
+	if s, ok := vv.values[k]; ok {
+		return s.v
+	}
+	return 0
+}
+
+func (vv *valueVec) write(w io.Writer) error {
+	vv.mu.Lock()
+	defer vv.mu.Unlock()
+	if err := vv.header(w); err != nil {
+		return err
+	}
+	for _, k := range sortedKeys(vv.values) {
+		s := vv.values[k]
+		if _, err := fmt.Fprintf(w, "%s%s %s\n", vv.name, vv.labelString(s.labels, ""), formatFloat(s.v)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CounterVec is a monotonically increasing value partitioned by labels
+type CounterVec struct {
+	valueVec
+}
+
+// Register a new counter vector
+func (r *Registry) NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{valueVec{desc: desc{name, help, "counter", labels}, values: map[string]*value{}}}
+	r.register(name, c)
+	return c
+}
+
+// Increase the counter by 1
+func (c *CounterVec) Inc(labels ...string) {
+	c.add(1, labels)
+}
+
+// Increase the counter by delta, negative values are ignored
+func (c *CounterVec) Add(delta float64, labels ...string) {
+	if delta < 0 {
+		return
+	}
+	c.add(delta, labels)
+}
+
+// Current value of the counter
+func (c *CounterVec) Value(labels ...string) float64 {
+	return c.get(labels)
+}
+
+// GaugeVec is a value that can go up and down partitioned by labels
+type GaugeVec struct {
+	valueVec
+}
+
+// Register a new gauge vector
+func (r *Registry) NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	g := &GaugeVec{valueVec{desc: desc{name, help, "gauge", labels}, values: map[string]*value{}}}
+	r.register(name, g)
+	return g
+}
+
+// Increase the gauge by 1
+func (g *GaugeVec) Inc(labels ...string) {
+	g.add(1, labels)
+}
+
+// Decrease the gauge by 1
+func (g *GaugeVec) Dec(labels ...string) {
+	g.add(-1, labels)
+}
+
+// Add delta to the gauge
+func (g *GaugeVec) Add(delta float64, labels ...string) {
+	g.add(delta, labels)
+}
+
+// Set the gauge to v
+func (g *GaugeVec) Set(v float64, labels ...string) {
+	g.set(v, labels)
+}
+
+// Current value of the gauge
+func (g *GaugeVec) Value(labels ...string) float64 {
+	return g.get(labels)
+}
+
+// histogram is a single bucketed sample set
+type histogram struct {
+	labels []string
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+// HistogramVec counts observations in configurable buckets partitioned by labels
+type HistogramVec struct {
+	desc
+	buckets []float64
+	mu      sync.Mutex
+	values  map[string]*histogram
+}
+
+// Register a new histogram vector, DefaultBuckets are used if buckets is empty
+func (r *Registry) NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+	b := append([]float64(nil), buckets...)
+	sort.Float64s(b)
+	h := &HistogramVec{desc: desc{name, help, "histogram", labels}, buckets: b, values: map[string]*histogram{}}
+	r.register(name, h)
+	return h
+}
+
+// Add a single observation
+func (h *HistogramVec) Observe(v float64, labels ...string) {
+	k := h.key(labels)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s, ok := h.values[k]
+	if !ok {
+		s = &histogram{labels: append([]string(nil), labels...), counts: make([]uint64, len(h.buckets))}
+		h.values[k] = s
+	}
+	for i, upper := range h.buckets {
+		if v <= upper {
+			s.counts[i]++
+		}
+	}
+	s.count++
+	s.sum += v
+}
+
+// Number of observations
+func (h *HistogramVec) Count(labels ...string) uint64 {
+	k := h.key(labels)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if s, ok := h.values[k]; ok {
+		return s.count
+	}
+	return 0
+}
+
+func (h *HistogramVec) write(w io.Writer) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if err := h.header(w); err != nil {
+		return err
+	}
+	for _, k := range sortedKeys(h.values) {
+		s := h.values[k]
+		for i, upper := range h.buckets {
+			le := `le="` + formatFloat(upper) + `"`
+			if _, err := fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, h.labelString(s.labels, le), s.counts[i]); err != nil {
+				return err
+			}
+		}
+		if _, err := fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, h.labelString(s.labels, `le="+Inf"`), s.count); err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "%s_sum%s %s\n", h.name, h.labelString(s.labels, ""), formatFloat(s.sum)); err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "%s_count%s %d\n", h.name, h.labelString(s.labels, ""), s.count); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func sortedKeys(m interface{}) []string {
+	var keys []string
+	switch vals := m.(type) {
+	case map[string]*value:
+		for k := range vals {
+			keys = append(keys, k)
+		}
+	case map[string]*histogram:
+		for k := range vals {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func formatFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "+Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	case math.IsNaN(f):
+		return "NaN"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+
+var helpEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+
+func escapeLabel(s string) string {
+	return labelEscaper.Replace(s)
+}
+
+func escapeHelp(s string) string {
+	return helpEscaper.Replace(s)
+}
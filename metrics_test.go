@@ -0,0 +1,77 @@
+package acrouter
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zfs123/go-ac-router/handle"
+)
+
+func TestMetrics(t *testing.T) {
+	r, err := New(Metrics(""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.AddApiRoute("/hello", "GET", "hello api", nil, nil, func(action handle.Action, response handle.Response) {
+		response.Response(http.StatusOK, "hello")
+	})
+
+	performRequest(r, "GET", "/hello")
+	performRequest(r, "GET", "/hello")
+	w := performRequest(r, "GET", "/metrics")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.True(t, strings.HasPrefix(w.Header().Get("Content-Type"), "text/plain; version=0.0.4"))
+
+	body := w.Body.String()
+	assert.Contains(t, body, `acrouter_http_requests_total{method="GET",route="/hello",code="200"} 2`)
+	assert.Contains(t, body, `acrouter_http_request_duration_seconds_count{method="GET",route="/hello"} 2`)
+	assert.Contains(t, body, `acrouter_http_response_size_bytes_bucket{method="GET",route="/hello",le="+Inf"} 2`)
+	assert.Contains(t, body, `acrouter_http_requests_in_flight{method="GET",route="/metrics"} 1`)
+}
+
+func TestMetricsDisabled(t *testing.T) {
+	r, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := performRequest(r, "GET", "/metrics")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestMetricsTextfile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	os.Args = []string{"-", "users_fail"}
+	r, _ := New(MetricsTextfile(dir))
+	r.cli.App.Writer = &bytes.Buffer{}
+	r.AddMultiRoute("/users/fail", "GET", "fail", nil, nil, func(action handle.Action, response handle.Response) {
+		response.SendSimpleFail("failed")
+	})
+	r.Run()
+
+	file := filepath.Join(dir, "acrouter_cli_users_fail.prom")
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Contains(t, string(b), "# TYPE acrouter_cli_last_run_exit_code gauge\n")
+	assert.Contains(t, string(b), `acrouter_cli_last_run_exit_code{command="users/fail"} 1`)
+	assert.Contains(t, string(b), `acrouter_cli_last_run_timestamp_seconds{command="users/fail"}`)
+	info, _ := os.Stat(file)
+	assert.Equal(t, os.FileMode(0644), info.Mode().Perm())
+
+	// only the textfile is left behind
+	files, _ := ioutil.ReadDir(dir)
+	assert.Len(t, files, 1)
+}
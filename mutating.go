@@ -0,0 +1,107 @@
+package acrouter
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/urfave/cli/v2"
+	"github.com/zfs123/go-ac-router/handle"
+	"github.com/zfs123/go-ac-router/utils"
+)
+
+// DryRunParam is the api parameter asking a mutating route for a dry run
+const DryRunParam = "dry_run"
+
+// Declare the route as changing state, it accepts dry runs
+func Mutating() RouteOption {
+	return func(route *Route) {
+		route.Mutating = true
+	}
+}
+
+// Declare the route as destroying data, its cli command asks for confirmation
+func Destructive() RouteOption {
+	return func(route *Route) {
+		route.Mutating = true
+		route.Destructive = true
+	}
+}
+
+// Mark the request as a dry run if the dry_run parameter is true
+func dryRunMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		value, ok := c.GetQuery(DryRunParam)
+		if !ok {
+			value, ok = c.GetPostForm(DryRunParam)
+		}
+		if !ok || value == "" {
+			c.Next()
+			return
+		}
+		dryRun, err := strconv.ParseBool(value)
+		if err != nil {
+			abortWithError(c, http.StatusBadRequest, DryRunParam+" must be a boolean")
+			return
+		}
+		c.Request = c.Request.WithContext(handle.ContextWithDryRun(c.Request.Context(), dryRun))
+		c.Next()
+	}
+}
+
+// Flags added to the cli commands of mutating routes
+func mutatingFlags(route *Route) []cli.Flag {
+	flags := []cli.Flag{
+		&cli.BoolFlag{Name: "dry-run", Usage: "report the changes without making them"},
+	}
+	if route.Destructive {
+		flags = append(flags, &cli.BoolFlag{Name: "yes", Aliases: []string{"y"}, Usage: "skip the confirmation"})
+	}
+	return flags
+}
+
+// Mark the command as a dry run and ask before destructive changes,
+// an error is returned if the command must not run
+//
+// Only a terminal is asked, scripts and piped input would answer with their
+// own lines, so they have to pass --yes
+func confirmMutation(c *cli.Context, command string, route *Route) error {
+	dryRun := c.Bool("dry-run")
+	c.Context = handle.ContextWithDryRun(c.Context, dryRun)
+	if !route.Destructive || dryRun || c.Bool("yes") {
+		return nil
+	}
+	if f, ok := c.App.Reader.(*os.File); !ok || !utils.IsTerminal(f) {
+		return cli.Exit("confirmation required, pass --yes", 1)
+	}
+	_, _ = fmt.Fprintf(c.App.ErrWriter, "%s can not be undone, continue? [y/N] ", command)
+	answer := strings.ToLower(strings.TrimSpace(readLine(c.App.Reader)))
+	if answer != "y" && answer != "yes" {
+		return cli.Exit("aborted", 1)
+	}
+	return nil
+}
+
+// Read up to the end of the line without buffering past it,
+// so the rest of the input stays available to the command
+func readLine(r io.Reader) string {
+	var line []byte
+	b := make([]byte, 1)
+	for {
+		n, err := r.Read(b)
+		if n > 0 {
+			if b[0] == '\n' {
+				break
+			}
+			line = append(line, b[0])
+		}
+		if err != nil {
+			break
+		}
+	}
+	return string(line)
+}
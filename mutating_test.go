@@ -0,0 +1,65 @@
+package acrouter
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/urfave/cli/v2"
+	"github.com/zfs123/go-ac-router/handle"
+)
+
+func newMutatingRouter(out *bytes.Buffer) *Router {
+	r, _ := New()
+	r.AddMultiRoute("/users/remove", "DELETE", "remove user", &userParams{}, nil, func(action handle.Action, response handle.Response) {
+		response.SendSimpleOk(fmt.Sprintf("removed %s dry_run=%t", action.String("id"), action.DryRun()))
+	}, Destructive())
+	r.AddApiRoute("/users/list", "GET", "list users", nil, nil, func(action handle.Action, response handle.Response) {
+		response.SendSimpleOk(fmt.Sprintf("dry_run=%t", action.DryRun()))
+	})
+	if out != nil {
+		r.cli.App.Writer = out
+		r.cli.App.ErrWriter = out
+		r.cli.App.ExitErrHandler = func(*cli.Context, error) {}
+	}
+	return r
+}
+
+func TestDryRunApi(t *testing.T) {
+	r := newMutatingRouter(nil)
+	assert.Contains(t, performRequest(r, "DELETE", "/users/remove?id=1&dry_run=true").Body.String(), "removed 1 dry_run=true")
+	assert.Contains(t, performRequest(r, "DELETE", "/users/remove?id=1").Body.String(), "removed 1 dry_run=false")
+	assert.Equal(t, http.StatusBadRequest, performRequest(r, "DELETE", "/users/remove?id=1&dry_run=maybe").Code)
+	assert.Contains(t, performRequest(r, "GET", "/users/list?dry_run=true").Body.String(), "dry_run=false")
+}
+
+func TestConfirmation(t *testing.T) {
+	cases := []struct {
+		args   []string
+		input  string
+		output string
+		err    string
+	}{
+		// input which is not a terminal never answers the prompt
+		{[]string{"--id", "1"}, "y\n", "", "confirmation required, pass --yes"},
+		{[]string{"--id", "1"}, "", "", "confirmation required, pass --yes"},
+		{[]string{"--id", "1", "-y"}, "y\n", "removed 1 dry_run=false\n", ""},
+		{[]string{"--id", "1", "--dry-run"}, "", "removed 1 dry_run=true\n", ""},
+	}
+	for _, c := range cases {
+		out := &bytes.Buffer{}
+		r := newMutatingRouter(out)
+		r.cli.App.Reader = strings.NewReader(c.input)
+		r.cli.addBuiltinCommands()
+		err := r.cli.App.Run(append([]string{"-", "users_remove"}, c.args...))
+		assert.Equal(t, c.output, out.String(), strings.Join(c.args, " "))
+		if c.err == "" {
+			assert.NoError(t, err)
+		} else {
+			assert.EqualError(t, err, c.err)
+		}
+	}
+}
@@ -1,5 +1,15 @@
 package acrouter
 
+import (
+	"time"
+
+	"github.com/zfs123/go-ac-router/auth"
+	"github.com/zfs123/go-ac-router/handle"
+	"github.com/zfs123/go-ac-router/jobs"
+	"github.com/zfs123/go-ac-router/ratelimit"
+	"github.com/zfs123/go-ac-router/trace"
+)
+
 type Option func(*RouterConfig)
 
 func Address(ip string, port int) Option {
@@ -21,3 +31,178 @@ func Tls(key, cert string) Option {
 		s.Cert = cert
 	}
 }
+
+// Enable prometheus metrics on path, "/metrics" is used if path is empty
+func Metrics(path string) Option {
+	return func(s *RouterConfig) {
+		if path == "" {
+			path = "/metrics"
+		}
+		s.MetricsPath = path
+	}
+}
+
+// Write the last run of every cli command to a textfile in dir for the
+// node exporter textfile collector, a cli process is gone before a scrape
+func MetricsTextfile(dir string) Option {
+	return func(s *RouterConfig) {
+		s.MetricsTextfileDir = dir
+	}
+}
+
+// Enable tracing, spans of every route and command are sent to exporter
+func Tracing(exporter trace.Exporter) Option {
+	return func(s *RouterConfig) {
+		s.TraceExporter = exporter
+	}
+}
+
+// Set the header used to accept and echo request ids
+func RequestIDHeader(name string) Option {
+	return func(s *RouterConfig) {
+		s.RequestIDHeader = name
+	}
+}
+
+// Authenticate all routes with authenticators unless a route sets its own
+func Authentication(authenticators ...auth.Authenticator) Option {
+	return func(s *RouterConfig) {
+		s.Authenticators = authenticators
+	}
+}
+
+// Enforce the permissions and roles declared by routes with policy
+func Authorization(policy *auth.Policy) Option {
+	return func(s *RouterConfig) {
+		s.Policy = policy
+	}
+}
+
+// Limit every route to rate requests per second with burst, counted per key
+func DefaultRateLimit(rate float64, burst int, key RateKeyFunc) Option {
+	return func(s *RouterConfig) {
+		s.RateLimit = &RateLimitConfig{Limit: ratelimit.Limit{Rate: rate, Burst: burst}, Key: key}
+	}
+}
+
+// Keep rate limit buckets in store, shared stores enforce limits across processes
+func RateLimitStore(store ratelimit.Store) Option {
+	return func(s *RouterConfig) {
+		s.RateLimitStore = store
+	}
+}
+
+// Enable cross-origin resource sharing, preflight requests of every api route are answered
+func CORS(config CORSConfig) Option {
+	return func(s *RouterConfig) {
+		s.CORS = &config
+	}
+}
+
+// Set the read header, read, write and idle timeouts of the http server
+func ServerTimeouts(readHeader, read, write, idle time.Duration) Option {
+	return func(s *RouterConfig) {
+		s.ReadHeaderTimeout = readHeader
+		s.ReadTimeout = read
+		s.WriteTimeout = write
+		s.IdleTimeout = idle
+	}
+}
+
+// Set the default handler timeout of all routes
+func HandlerTimeout(d time.Duration) Option {
+	return func(s *RouterConfig) {
+		s.HandlerTimeout = d
+	}
+}
+
+// Set the maximum request header size and the default maximum body size of all routes
+func RequestLimits(maxHeaderBytes int, maxBodyBytes int64) Option {
+	return func(s *RouterConfig) {
+		s.MaxHeaderBytes = maxHeaderBytes
+		s.MaxBodyBytes = maxBodyBytes
+	}
+}
+
+// Set the default memory used to parse multipart forms
+func MultipartMemory(n int64) Option {
+	return func(s *RouterConfig) {
+		s.MaxMultipartMemory = n
+	}
+}
+
+// Keep the jobs of async routes in store and register the job routes under path
+func Jobs(store jobs.Store, path string) Option {
+	return func(s *RouterConfig) {
+		s.JobStore = store
+		if path != "" {
+			s.JobsPath = path
+		}
+	}
+}
+
+// Keep finished jobs for ttl, forever if zero
+func JobTTL(ttl time.Duration) Option {
+	return func(s *RouterConfig) {
+		s.JobTTL = ttl
+	}
+}
+
+// Set keepalive and message limits of websocket routes, zero fields keep their defaults
+func WebSocket(config WebSocketConfig) Option {
+	return func(s *RouterConfig) {
+		defaults := defaultWebSocketConfig()
+		if config.PingInterval == 0 {
+			config.PingInterval = defaults.PingInterval
+		}
+		if config.PongWait == 0 {
+			config.PongWait = defaults.PongWait
+		}
+		if config.WriteWait == 0 {
+			config.WriteWait = defaults.WriteWait
+		}
+		if config.MaxMessageSize == 0 {
+			config.MaxMessageSize = defaults.MaxMessageSize
+		}
+		s.WebSocket = config
+	}
+}
+
+// Serve the api routes as json-rpc 2.0 methods on path, /rpc if empty
+func JSONRPC(path string) Option {
+	return func(s *RouterConfig) {
+		if path == "" {
+			path = DefaultJSONRPCPath
+		}
+		s.JSONRPCPath = path
+	}
+}
+
+// Wrap all api and cli output in an envelope of data, error and meta,
+// shape turns the envelope into the body sent and keeps it as is if nil
+func ResponseEnvelope(shape handle.EnvelopeFunc) Option {
+	return func(s *RouterConfig) {
+		if shape == nil {
+			shape = handle.DefaultEnvelope
+		}
+		s.Envelope = shape
+	}
+}
+
+// Serve batches of sub-requests on path, /batch if empty
+//
+// Up to concurrency sub-requests run in parallel, a batch holds at most
+// maxRequests of them, zero values keep the defaults of 1 and 50
+func Batch(path string, concurrency, maxRequests int) Option {
+	return func(s *RouterConfig) {
+		if path == "" {
+			path = DefaultBatchPath
+		}
+		if maxRequests <= 0 {
+			maxRequests = DefaultBatchMaxRequests
+		}
+		s.BatchPath = path
+		s.BatchConcurrency = concurrency
+		s.BatchMaxRequests = maxRequests
+	}
+}
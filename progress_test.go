@@ -0,0 +1,64 @@
+package acrouter
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zfs123/go-ac-router/handle"
+)
+
+func progressHandler(action handle.Action, response handle.Response) {
+	response.Progress(handle.Progress{Step: 1, Steps: 2, Message: "loading"})
+	response.Progress(handle.Progress{Percent: 100, Message: "saving"})
+	response.Response(http.StatusOK, "done")
+}
+
+func TestApiProgress(t *testing.T) {
+	r, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.AddApiRoute("/import", "POST", "import api", nil, nil, progressHandler)
+
+	w := performRequest(r, "POST", "/import", header{"Accept", "text/event-stream"})
+	assert.Equal(t, "text/event-stream", w.Header().Get("Content-Type"))
+	assert.Equal(t, "event: progress\ndata: {\"percent\":0,\"message\":\"loading\",\"step\":1,\"steps\":2}\n\n"+
+		"event: progress\ndata: {\"percent\":100,\"message\":\"saving\"}\n\n"+
+		"event: result\ndata: {\"code\":200,\"data\":\"done\"}\n\n", w.Body.String())
+
+	w = performRequest(r, "POST", "/import", header{"Accept", "application/x-ndjson"})
+	assert.Equal(t, "{\"progress\":{\"percent\":0,\"message\":\"loading\",\"step\":1,\"steps\":2}}\n"+
+		"{\"progress\":{\"percent\":100,\"message\":\"saving\"}}\n"+
+		"{\"result\":{\"code\":200,\"data\":\"done\"}}\n", w.Body.String())
+
+	w = performRequest(r, "POST", "/import")
+	assert.Equal(t, `"done"`, w.Body.String())
+}
+
+func TestCliProgress(t *testing.T) {
+	os.Args = []string{"-", "import"}
+	r, _ := New()
+	out, errOut := &bytes.Buffer{}, &bytes.Buffer{}
+	r.cli.App.Writer = out
+	r.cli.App.ErrWriter = errOut
+	r.AddCliCommandByStruct("import", "import command", nil, progressHandler)
+	r.Run()
+
+	assert.Equal(t, "progress  50% step 1/2 loading\nprogress 100% saving\n", errOut.String())
+	assert.Equal(t, "code 200,msg \"done\"\n", out.String())
+}
+
+func TestJobProgress(t *testing.T) {
+	r, _ := New()
+	r.AddApiRoute("/import", "POST", "import api", nil, nil, progressHandler, Async())
+	performRequest(r, "POST", "/import")
+	list, _ := r.Jobs().Store().List()
+	job, err := r.Jobs().Follow(context.Background(), list[0].ID, time.Millisecond, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "saving", job.Progress.Message)
+}
@@ -0,0 +1,109 @@
+package acrouter
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/zfs123/go-ac-router/auth"
+	"github.com/zfs123/go-ac-router/logger"
+	"github.com/zfs123/go-ac-router/ratelimit"
+	"go.uber.org/zap"
+)
+
+// RateKeyFunc selects the bucket a request is counted in
+type RateKeyFunc func(c *gin.Context) string
+
+// RateLimitConfig limits the request rate of a route per key
+type RateLimitConfig struct {
+	Limit ratelimit.Limit
+	// Key of the bucket, ByClientIP if nil
+	Key RateKeyFunc
+}
+
+// Count requests per client ip
+func ByClientIP(c *gin.Context) string {
+	return "ip:" + c.ClientIP()
+}
+
+// Count requests per api key of header once the key passed authentication,
+// per client ip otherwise, so made up keys can not open new buckets
+func ByAPIKey(header string) RateKeyFunc {
+	return func(c *gin.Context) string {
+		p := auth.PrincipalFromContext(c.Request.Context())
+		if key := c.GetHeader(header); key != "" && p != nil && p.Method == "api_key" {
+			return "key:" + key
+		}
+		return ByClientIP(c)
+	}
+}
+
+// Count requests per authenticated principal, per client ip for anonymous callers
+func ByPrincipal(c *gin.Context) string {
+	if p := auth.PrincipalFromContext(c.Request.Context()); p != nil {
+		return "principal:" + p.Name
+	}
+	return ByClientIP(c)
+}
+
+// Limit the route to rate requests per second with burst, counted per key
+func RateLimit(rate float64, burst int, key RateKeyFunc) RouteOption {
+	return func(route *Route) {
+		route.RateLimit = &RateLimitConfig{Limit: ratelimit.Limit{Rate: rate, Burst: burst}, Key: key}
+	}
+}
+
+// Limit the number of requests of the route served concurrently
+func MaxInFlight(n int) RouteOption {
+	return func(route *Route) {
+		route.MaxInFlight = n
+	}
+}
+
+// Reject requests exceeding the rate limit of the route with 429
+func rateLimitMiddleware(store ratelimit.Store, config *RateLimitConfig, route string, m *routerMetrics) gin.HandlerFunc {
+	key := config.Key
+	if key == nil {
+		key = ByClientIP
+	}
+	return func(c *gin.Context) {
+		res, err := store.Take(route+"|"+key(c), config.Limit)
+		if err != nil {
+			// a broken shared store must not take the api down
+			logger.Warn("rate limit store failed", zap.String("route", route), zap.Error(err))
+			c.Next()
+			return
+		}
+		c.Header("X-RateLimit-Limit", strconv.Itoa(config.Limit.Capacity()))
+		c.Header("X-RateLimit-Remaining", strconv.Itoa(res.Remaining))
+		if !res.Allowed {
+			m.rateLimited.Inc(route, "rate")
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(res.RetryAfter.Seconds()))))
+			abortWithError(c, http.StatusTooManyRequests, "rate limit exceeded")
+			return
+		}
+		c.Next()
+	}
+}
+
+// Reject requests exceeding the concurrency cap of the route with 429
+func concurrencyMiddleware(max int, route string, m *routerMetrics) gin.HandlerFunc {
+	slots := make(chan struct{}, max)
+	return func(c *gin.Context) {
+		select {
+		case slots <- struct{}{}:
+		default:
+			m.rateLimited.Inc(route, "concurrency")
+			c.Header("Retry-After", "1")
+			abortWithError(c, http.StatusTooManyRequests, "too many concurrent requests")
+			return
+		}
+		m.concurrency.Inc(route)
+		defer func() {
+			<-slots
+			m.concurrency.Dec(route)
+		}()
+		c.Next()
+	}
+}
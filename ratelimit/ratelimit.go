@@ -0,0 +1,96 @@
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// Limit is a token bucket refilled with Rate tokens per second holding up to Burst tokens
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// Capacity is the number of tokens the bucket holds, at least one
+func (l Limit) Capacity() int {
+	if l.Burst < 1 {
+		return 1
+	}
+	return l.Burst
+}
+
+// Result of taking a token
+type Result struct {
+	Allowed bool
+	// Tokens left in the bucket
+	Remaining int
+	// Time until the next token is available, zero if allowed
+	RetryAfter time.Duration
+}
+
+// Store keeps the token buckets, implementations backed by a shared
+// store let several processes enforce the same limits
+type Store interface {
+	Take(key string, limit Limit) (Result, error)
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// MemoryStore keeps token buckets in process memory
+type MemoryStore struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	now     func() time.Time
+	// buckets idle for longer than this are dropped
+	idle      time.Duration
+	lastSweep time.Time
+}
+
+// Create an in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{buckets: map[string]*bucket{}, now: time.Now, idle: 10 * time.Minute}
+}
+
+// Take a token from the bucket of key
+func (s *MemoryStore) Take(key string, limit Limit) (Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	s.sweep(now)
+
+	burst := float64(limit.Capacity())
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &bucket{tokens: burst, last: now}
+		s.buckets[key] = b
+	}
+	b.tokens = math.Min(burst, b.tokens+now.Sub(b.last).Seconds()*limit.Rate)
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return Result{Allowed: true, Remaining: int(b.tokens)}, nil
+	}
+	if limit.Rate <= 0 {
+		return Result{RetryAfter: time.Hour}, nil
+	}
+	wait := time.Duration((1 - b.tokens) / limit.Rate * float64(time.Second))
+	return Result{RetryAfter: wait}, nil
+}
+
+// Drop idle buckets at most once per idle period
+func (s *MemoryStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < s.idle {
+		return
+	}
+	s.lastSweep = now
+	for k, b := range s.buckets {
+		if now.Sub(b.last) > s.idle {
+			delete(s.buckets, k)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package acrouter
+
+import (
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zfs123/go-ac-router/auth"
+	"github.com/zfs123/go-ac-router/handle"
+)
+
+func TestRateLimit(t *testing.T) {
+	r, err := New(Metrics(""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.AddApiRoute("/limited", "GET", "limited api", nil, nil, func(action handle.Action, response handle.Response) {
+		response.SendSimpleOk("ok")
+	}, RateLimit(0.001, 2, ByAPIKey("X-API-Key")),
+		Authenticate(auth.NewAPIKeyAuthenticator(map[string]string{"a": "alice", "b": "bob"})))
+
+	w := performRequest(r, "GET", "/limited", header{"X-API-Key", "a"})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "2", w.Header().Get("X-RateLimit-Limit"))
+	assert.Equal(t, "1", w.Header().Get("X-RateLimit-Remaining"))
+	assert.Equal(t, http.StatusOK, performRequest(r, "GET", "/limited", header{"X-API-Key", "a"}).Code)
+	w = performRequest(r, "GET", "/limited", header{"X-API-Key", "a"})
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.NotEmpty(t, w.Header().Get("Retry-After"))
+	assert.Equal(t, http.StatusOK, performRequest(r, "GET", "/limited", header{"X-API-Key", "b"}).Code)
+
+	// unknown keys are refused before they could open a bucket
+	assert.Equal(t, http.StatusUnauthorized, performRequest(r, "GET", "/limited", header{"X-API-Key", "c"}).Code)
+
+	w = performRequest(r, "GET", "/metrics")
+	assert.Contains(t, w.Body.String(), `acrouter_rate_limited_total{route="GET /limited",limiter="rate"} 1`)
+}
+
+func TestMaxInFlight(t *testing.T) {
+	r, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	r.AddApiRoute("/slow", "GET", "slow api", nil, nil, func(action handle.Action, response handle.Response) {
+		entered <- struct{}{}
+		<-release
+		response.SendSimpleOk("ok")
+	}, MaxInFlight(1))
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		assert.Equal(t, http.StatusOK, performRequest(r, "GET", "/slow").Code)
+	}()
+	<-entered
+	assert.Equal(t, http.StatusTooManyRequests, performRequest(r, "GET", "/slow").Code)
+	close(release)
+	wg.Wait()
+}
+
+func TestRateLimitKeys(t *testing.T) {
+	r, _ := New()
+	ok := func(action handle.Action, response handle.Response) {
+		response.SendSimpleOk("ok")
+	}
+	// without authentication the api key header is ignored
+	r.AddApiRoute("/open", "GET", "open api", nil, nil, ok, RateLimit(0.001, 0, ByAPIKey("X-API-Key")))
+
+	w := performRequest(r, "GET", "/open", header{"X-API-Key", "a"})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "1", w.Header().Get("X-RateLimit-Limit"))
+	assert.Equal(t, http.StatusTooManyRequests, performRequest(r, "GET", "/open", header{"X-API-Key", "b"}).Code)
+}
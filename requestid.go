@@ -0,0 +1,47 @@
+package acrouter
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/urfave/cli/v2"
+	"github.com/zfs123/go-ac-router/handle"
+	"github.com/zfs123/go-ac-router/utils"
+)
+
+// DefaultRequestIDHeader is the header used to accept and echo request ids
+const DefaultRequestIDHeader = "X-Request-ID"
+
+// Longest request id accepted from clients
+const maxRequestIDLength = 128
+
+// Accept the request id of the client or generate one, and echo it in the response
+func requestIDMiddleware(headerName string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(headerName)
+		if !validRequestID(id) {
+			id = utils.RandomHex(16)
+		}
+		c.Header(headerName, id)
+		c.Request = c.Request.WithContext(handle.ContextWithRequestID(c.Request.Context(), id))
+		c.Next()
+	}
+}
+
+// Generate a request id for a cli command
+func startCliRequest(c *cli.Context) string {
+	id := utils.RandomHex(16)
+	c.Context = handle.ContextWithRequestID(c.Context, id)
+	return id
+}
+
+// Only accept short printable ids so they are safe to log and echo
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,126 @@
+package acrouter
+
+import (
+	"time"
+
+	"github.com/zfs123/go-ac-router/auth"
+	"github.com/zfs123/go-ac-router/handle"
+)
+
+// Route describes a route registered on the router
+type Route struct {
+	Path        string
+	Method      string
+	Description string
+	Params      interface{}
+	Response    interface{}
+	HandleFunc  handle.Func
+	// Authenticators of the route, the router default is used if nil
+	Authenticators []auth.Authenticator
+	// Public routes skip authentication
+	Public bool
+	// Permissions required to call the route
+	Permissions []string
+	// Roles of which one is required to call the route
+	Roles []string
+	// Attribute rules checked on every call
+	Rules []auth.Rule
+	// Rate limit of the route, the router default is used if nil
+	RateLimit *RateLimitConfig
+	// Maximum number of concurrent requests, unlimited if zero
+	MaxInFlight int
+	// Handler timeout, the router default is used if zero
+	Timeout time.Duration
+	// Maximum request body size, the router default is used if zero
+	MaxBodyBytes int64
+	// Memory used to parse multipart forms, the router default is used if zero
+	MaxMultipartMemory int64
+	// Run the handler as a background job
+	Async bool
+	// Handler of websocket routes, HandleFunc is nil for them
+	WebSocketFunc handle.WebSocketFunc
+	// Name of the json-rpc method calling the route
+	RPCMethod string
+	// Dynamic completion of flag values by flag name
+	Completions map[string]CompleteFunc
+	// The route changes state and accepts dry runs
+	Mutating bool
+	// The route destroys data, its cli command asks for confirmation
+	Destructive bool
+	// The route sends files, its cli command writes them to --out
+	Downloads bool
+	// Caching headers of successful reads
+	Cache *handle.CachePolicy
+	// Current version of the resource of a request, checked before the handler runs
+	Version VersionFunc
+}
+
+// RouteOption configures a single route
+type RouteOption func(*Route)
+
+// Authenticate the route with authenticators, tried in order
+func Authenticate(authenticators ...auth.Authenticator) RouteOption {
+	return func(route *Route) {
+		route.Authenticators = authenticators
+	}
+}
+
+// Make the route callable without credentials
+func Public() RouteOption {
+	return func(route *Route) {
+		route.Public = true
+	}
+}
+
+func newRoute(path, method, description string, params, response interface{}, handleFunc handle.Func, opts []RouteOption) *Route {
+	route := &Route{
+		Path:        path,
+		Method:      method,
+		Description: description,
+		Params:      params,
+		Response:    response,
+		HandleFunc:  handleFunc,
+	}
+	for _, opt := range opts {
+		opt(route)
+	}
+	return route
+}
+
+// Get all routes registered by AddApiRoute and AddMultiRoute
+func (r *Router) Routes() []*Route {
+	return r.routes
+}
+
+// RouteGroup registers routes sharing a path prefix and route options
+type RouteGroup struct {
+	router *Router
+	prefix string
+	opts   []RouteOption
+}
+
+// Create a route group, opts are applied before the options of each route
+func (r *Router) Group(prefix string, opts ...RouteOption) *RouteGroup {
+	return &RouteGroup{router: r, prefix: prefix, opts: opts}
+}
+
+// Create a nested group
+func (g *RouteGroup) Group(prefix string, opts ...RouteOption) *RouteGroup {
+	return &RouteGroup{router: g.router, prefix: g.prefix + prefix, opts: g.mergeOptions(opts)}
+}
+
+// Generate cli and api routes of the group simultaneously
+func (g *RouteGroup) AddMultiRoute(path string, method string, description string, params interface{}, response interface{}, handleFunc handle.Func, opts ...RouteOption) {
+	g.router.AddMultiRoute(g.prefix+path, method, description, params, response, handleFunc, g.mergeOptions(opts)...)
+}
+
+// Add api route to the group
+func (g *RouteGroup) AddApiRoute(path string, method string, description string, params interface{}, response interface{}, handleFunc handle.Func, opts ...RouteOption) {
+	g.router.AddApiRoute(g.prefix+path, method, description, params, response, handleFunc, g.mergeOptions(opts)...)
+}
+
+func (g *RouteGroup) mergeOptions(opts []RouteOption) []RouteOption {
+	merged := make([]RouteOption, 0, len(g.opts)+len(opts))
+	merged = append(merged, g.opts...)
+	return append(merged, opts...)
+}
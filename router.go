@@ -9,7 +9,12 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/pkg/errors"
 	"github.com/urfave/cli/v2"
+	"github.com/zfs123/go-ac-router/auth"
 	"github.com/zfs123/go-ac-router/handle"
+	"github.com/zfs123/go-ac-router/jobs"
+	"github.com/zfs123/go-ac-router/metrics"
+	"github.com/zfs123/go-ac-router/ratelimit"
+	"github.com/zfs123/go-ac-router/trace"
 	"github.com/zfs123/go-ac-router/utils"
 )
 
@@ -19,39 +24,176 @@ type RouterConfig struct {
 	DebugMode bool
 	Key       string
 	Cert      string
+	// Path of the prometheus metrics route, metrics are disabled if empty
+	MetricsPath string
+	// Directory the node exporter textfile collector reads, the last run of
+	// every cli command is written to it; disabled if empty
+	MetricsTextfileDir string
+	// Exporter of the spans of every route and command, tracing is disabled if nil
+	TraceExporter trace.Exporter
+	// Header used to accept and echo request ids
+	RequestIDHeader string
+	// Default authenticators of all routes, routes are open if empty
+	Authenticators []auth.Authenticator
+	// Policy enforcing the permissions and roles declared by routes
+	Policy *auth.Policy
+	// Default rate limit of all routes, unlimited if nil
+	RateLimit *RateLimitConfig
+	// Store of the rate limit buckets, in memory if nil
+	RateLimitStore ratelimit.Store
+	// Cross-origin resource sharing, disabled if nil
+	CORS *CORSConfig
+	// Time allowed to read request headers, protects against slowloris
+	ReadHeaderTimeout time.Duration
+	// Time allowed to read the whole request, unlimited if zero
+	ReadTimeout time.Duration
+	// Time allowed to write the response, unlimited if zero
+	WriteTimeout time.Duration
+	// Time keep-alive connections are kept open while idle
+	IdleTimeout time.Duration
+	// Maximum size of request headers
+	MaxHeaderBytes int
+	// Default handler timeout of all routes, unlimited if zero
+	HandlerTimeout time.Duration
+	// Default maximum request body size of all routes, unlimited if zero
+	MaxBodyBytes int64
+	// Default memory used to parse multipart forms
+	MaxMultipartMemory int64
+	// Store of the jobs of async routes, in memory if nil
+	JobStore jobs.Store
+	// Path the job routes are registered under
+	JobsPath string
+	// How long finished jobs are kept, forever if zero
+	JobTTL time.Duration
+	// Keepalive and message limits of websocket routes
+	WebSocket WebSocketConfig
+	// Path of the json-rpc endpoint, disabled if empty
+	JSONRPCPath string
+	// Path of the batch endpoint, disabled if empty
+	BatchPath string
+	// Number of sub-requests of a batch served in parallel
+	BatchConcurrency int
+	// Maximum number of sub-requests of a batch
+	BatchMaxRequests int
+	// Shape of the envelope wrapping all output, legacy bodies are sent if nil
+	Envelope handle.EnvelopeFunc
+	// Query parameter selecting response formats, only Accept is negotiated if empty
+	FormatParam string
 }
 
 type Router struct {
-	api    *ApiServer
-	cli    *CliServer
-	config RouterConfig
+	api     *ApiServer
+	cli     *CliServer
+	config  RouterConfig
+	metrics *routerMetrics
+	tracer  *trace.Tracer
+	routes  []*Route
+	// methods per route path once cors is enabled
+	corsPaths map[string]*corsPath
+	jobs      *jobs.Manager
+	jobRoutes bool
+	// async routes by job route name
+	asyncRoutes map[string]*Route
+	jobCommands bool
+	// routes by json-rpc method name
+	rpcMethods map[string]*Route
+	// routes by cli command name
+	commandRoutes map[string]*Route
 }
 
 func NewRouter(api *ApiServer, cli *CliServer) *Router {
 	return &Router{
-		api: api,
-		cli: cli,
+		api:           api,
+		cli:           cli,
+		metrics:       newRouterMetrics(metrics.NewRegistry()),
+		corsPaths:     map[string]*corsPath{},
+		jobs:          jobs.NewManager(jobs.NewMemoryStore(), DefaultJobTTL),
+		asyncRoutes:   map[string]*Route{},
+		rpcMethods:    map[string]*Route{},
+		commandRoutes: map[string]*Route{},
 	}
 }
 
 // Generate cli and api routes simultaneously
-func (r *Router) AddMultiRoute(path string, method string, description string, params interface{}, response interface{}, handleFunc handle.Func) {
-	r.AddApiRoute(path, method, description, params, response, handleFunc)
-	r.AddCliCommandByStruct(path[1:], description, params, handleFunc)
+func (r *Router) AddMultiRoute(path string, method string, description string, params interface{}, response interface{}, handleFunc handle.Func, opts ...RouteOption) {
+	r.AddApiRoute(path, method, description, params, response, handleFunc, opts...)
+	r.cli.AddCommand(r.buildCliCommand(path[1:], r.routes[len(r.routes)-1]))
 }
 
 // Add cli route by struct
 func (r *Router) AddCliCommandByStruct(path string, description string, params interface{}, handleFunc handle.Func) {
-	r.cli.AddCommand(&cli.Command{
-		Name:    strings.Replace(path, "/", "_", -1),
-		Aliases: []string{path},
-		Usage:   description,
-		Flags:   buildCliFlag(params),
-		Action: func(c *cli.Context) error {
-			handleFunc(handle.NewCliAction(c), handle.NewCliResponse(c))
-			return nil
-		},
-	})
+	r.cli.AddCommand(r.buildCliCommand(path, &Route{Description: description, Params: params, HandleFunc: handleFunc}))
+}
+
+// Build the cli command of route
+func (r *Router) buildCliCommand(path string, route *Route) *cli.Command {
+	flags := buildCliFlag(route.Params)
+	if route.Mutating {
+		flags = append(flags, mutatingFlags(route)...)
+	}
+	if route.Downloads {
+		flags = append(flags, downloadFlags()...)
+	}
+	if route.Async {
+		flags = append(flags, asyncFlags()...)
+		if !r.jobCommands {
+			r.jobCommands = true
+			r.cli.AddCommand(r.jobsCommand())
+		}
+	}
+	name := strings.Replace(path, "/", "_", -1)
+	r.commandRoutes[name] = route
+	return &cli.Command{
+		Name:        name,
+		Aliases:     []string{path},
+		Usage:       route.Description,
+		Description: route.Requirements(),
+		Flags:       flags,
+		Action:      r.cliAction(path, route),
+	}
+}
+
+// Wrap the handle func of route as cli action
+func (r *Router) cliAction(path string, route *Route) cli.ActionFunc {
+	handleFunc := route.HandleFunc
+	return func(c *cli.Context) error {
+		start := time.Now()
+		requestID := startCliRequest(c)
+		if r.config.Envelope != nil {
+			c.Context = handle.ContextWithEnvelope(c.Context, r.config.Envelope)
+		}
+		if r.tracer != nil {
+			span := startCliSpan(r.tracer, c, path)
+			span.SetAttribute("request_id", requestID)
+			defer span.Finish()
+		}
+		if route.Async {
+			if err := r.checkAsyncFlags(c); err != nil {
+				return err
+			}
+		}
+		if route.Mutating {
+			if err := confirmMutation(c, path, route); err != nil {
+				return err
+			}
+		}
+		if route.Async && (c.Bool("async") || c.Bool("wait")) {
+			return r.runCliJob(c, path, route)
+		}
+		response := handle.NewCliResponse(c)
+		handleFunc(handle.NewCliAction(c), response)
+		if code := response.ExitCode(); code != 0 {
+			trace.SpanFromContext(c.Context).SetAttribute("cli.exit_code", code)
+		}
+		if step := scriptStepFromContext(c.Context); step != nil {
+			step.code, step.data = response.Result()
+			step.exitCode = response.ExitCode()
+		}
+		if r.config.MetricsTextfileDir != "" {
+			observeCommand(r.config.MetricsTextfileDir, path, response.ExitCode(), time.Since(start))
+		}
+		return nil
+	}
 }
 
 // Add cli route by command
@@ -60,33 +202,116 @@ func (r *Router) AddCliCommand(c *cli.Command) {
 }
 
 // Add api route
-func (r *Router) AddApiRoute(path string, method string, description string, params interface{}, response interface{}, handleFunc handle.Func) {
-	autoAddApiRoute(r.api.Engine, path, method, func(context *gin.Context) {
-		handleFunc(handle.NewApiAction(context), handle.NewApiResponse(context))
+func (r *Router) AddApiRoute(path string, method string, description string, params interface{}, response interface{}, handleFunc handle.Func, opts ...RouteOption) {
+	route := newRoute(path, method, description, params, response, handleFunc, opts)
+	r.routes = append(r.routes, route)
+	r.addRPCMethod(route)
+	if route.Async {
+		r.addJobRoutes()
+	}
+	autoAddApiRoute(r.api.Engine, path, method, r.apiHandlers(route)...)
+	r.addCorsPreflight(path, method)
+}
+
+// Build the body limit and, if timeout is set, the handler timeout of endpoints not backed by a route
+func (r *Router) endpointLimits(timeout bool) []gin.HandlerFunc {
+	var handlers []gin.HandlerFunc
+	if r.config.MaxBodyBytes > 0 {
+		handlers = append(handlers, bodyLimitMiddleware(r.config.MaxBodyBytes))
+	}
+	if timeout && r.config.HandlerTimeout > 0 {
+		handlers = append(handlers, timeoutMiddleware(r.config.HandlerTimeout))
+	}
+	return handlers
+}
+
+// Build the handler chain of route
+func (r *Router) apiHandlers(route *Route) []gin.HandlerFunc {
+	var handlers []gin.HandlerFunc
+	if max := firstNonZero(route.MaxBodyBytes, r.config.MaxBodyBytes); max > 0 {
+		handlers = append(handlers, bodyLimitMiddleware(max))
+	}
+	if route.MaxMultipartMemory > 0 {
+		handlers = append(handlers, multipartMemoryMiddleware(route.MaxMultipartMemory))
+	}
+	if r.bindsFormatParam(route) {
+		handlers = append(handlers, formatParamMiddleware(""))
+	}
+	timeout := time.Duration(firstNonZero(int64(route.Timeout), int64(r.config.HandlerTimeout)))
+	if timeout > 0 && route.WebSocketFunc == nil {
+		handlers = append(handlers, timeoutMiddleware(timeout))
+	}
+	if authenticators := r.routeAuthenticators(route); len(authenticators) > 0 {
+		handlers = append(handlers, authMiddleware(authenticators))
+	}
+	name := route.Method + " " + route.Path
+	if limit := route.RateLimit; limit != nil || r.config.RateLimit != nil {
+		if limit == nil {
+			limit = r.config.RateLimit
+		}
+		handlers = append(handlers, rateLimitMiddleware(r.config.RateLimitStore, limit, name, r.metrics))
+	}
+	if route.MaxInFlight > 0 {
+		handlers = append(handlers, concurrencyMiddleware(route.MaxInFlight, name, r.metrics))
+	}
+	if route.protected() {
+		handlers = append(handlers, authorizeMiddleware(r.config.Policy, route))
+	}
+	if route.WebSocketFunc == nil {
+		handlers = append(handlers, r.conditionalMiddleware(route))
+	}
+	if route.Mutating {
+		handlers = append(handlers, dryRunMiddleware())
+	}
+	if route.Async {
+		return append(handlers, r.asyncApiHandler(route))
+	}
+	if route.WebSocketFunc != nil {
+		return append(handlers, r.webSocketHandler(route))
+	}
+	return append(handlers, func(context *gin.Context) {
+		route.HandleFunc(handle.NewApiAction(context), handle.NewApiResponse(context))
 	})
 }
 
-func autoAddApiRoute(engine *gin.Engine, path string, method string, handleFunc gin.HandlerFunc) {
+func autoAddApiRoute(engine *gin.Engine, path string, method string, handlers ...gin.HandlerFunc) {
 	switch method {
 	case "GET":
-		engine.GET(path, handleFunc)
+		engine.GET(path, handlers...)
 	case "POST":
-		engine.POST(path, handleFunc)
+		engine.POST(path, handlers...)
 	case "DELETE":
-		engine.DELETE(path, handleFunc)
+		engine.DELETE(path, handlers...)
 	case "PATCH":
-		engine.PATCH(path, handleFunc)
+		engine.PATCH(path, handlers...)
 	case "PUT":
-		engine.PUT(path, handleFunc)
+		engine.PUT(path, handlers...)
 	case "OPTIONS":
-		engine.OPTIONS(path, handleFunc)
+		engine.OPTIONS(path, handlers...)
 	case "HEAD":
-		engine.HEAD(path, handleFunc)
+		engine.HEAD(path, handlers...)
 	case "Any":
-		engine.Any(path, handleFunc)
+		engine.Any(path, handlers...)
 	}
 }
 
+func firstNonZero(values ...int64) int64 {
+	for _, v := range values {
+		if v != 0 {
+			return v
+		}
+	}
+	return 0
+}
+
+// Abort the request with an error envelope
+func abortWithError(c *gin.Context, code int, msg string) {
+	if code >= http.StatusBadRequest && handle.BodyLimitExceeded(c.Request.Context()) {
+		code, msg = http.StatusRequestEntityTooLarge, handle.ErrBodyTooLarge.Error()
+	}
+	c.AbortWithStatusJSON(code, handle.ErrorBody(c.Request.Context(), code, msg))
+}
+
 // Generate cli command parameters by the structure
 func buildCliFlag(flag interface{}) (fields []cli.Flag) {
 	_ = utils.RangeStruct(flag, func(value reflect.Value, field reflect.StructField) bool {
@@ -107,7 +332,7 @@ func buildCliFlag(flag interface{}) (fields []cli.Flag) {
 		case float64:
 			flag = &cli.Float64Flag{Name: alia, Usage: description, Required: require}
 		case string:
-			flag = &cli.StringFlag{Name: alia, Usage: description, Required: require}
+			flag = &cli.StringFlag{Name: alia, Usage: description, Required: require, TakesFile: utils.IsFile(field)}
 		case []string:
 			flag = &cli.StringSliceFlag{Name: alia, Usage: description, Required: require}
 		case time.Duration:
@@ -118,6 +343,9 @@ func buildCliFlag(flag interface{}) (fields []cli.Flag) {
 			flag = &cli.Uint64Flag{Name: alia, Usage: description, Required: require}
 		case time.Time:
 			flag = &cli.TimestampFlag{Name: alia, Usage: description, Required: require}
+		case *handle.File:
+			flag = &cli.StringFlag{Name: alia, Usage: strings.TrimSpace(description + " (path, " + handle.StdinPath + " for stdin)"),
+				Required: require, TakesFile: true}
 		}
 		fields = append(fields, flag)
 		return true
@@ -132,11 +360,32 @@ func New(opts ...Option) (*Router, error) {
 		DebugMode: false,
 		Key:       "",
 		Cert:      "",
+
+		RequestIDHeader:    DefaultRequestIDHeader,
+		ReadHeaderTimeout:  10 * time.Second,
+		IdleTimeout:        2 * time.Minute,
+		MaxHeaderBytes:     http.DefaultMaxHeaderBytes,
+		MaxMultipartMemory: 32 << 20,
+		JobsPath:           DefaultJobsPath,
+		JobTTL:             DefaultJobTTL,
+		FormatParam:        handle.FormatParam,
+		WebSocket:          defaultWebSocketConfig(),
 	}
 
 	for _, opt := range opts {
 		opt(&rc)
 	}
+	if rc.CORS != nil {
+		if err := rc.CORS.validate(); err != nil {
+			return nil, err
+		}
+	}
+	if rc.RateLimitStore == nil {
+		rc.RateLimitStore = ratelimit.NewMemoryStore()
+	}
+	if rc.JobStore == nil {
+		rc.JobStore = jobs.NewMemoryStore()
+	}
 
 	api := NewApiServer(rc.Addr, rc.Port)
 	if api == nil {
@@ -145,19 +394,61 @@ func New(opts ...Option) (*Router, error) {
 	if rc.DebugMode {
 		api.SetDebug()
 	}
+	api.keyFile = rc.Key
+	api.certFile = rc.Cert
+	api.Server.ReadHeaderTimeout = rc.ReadHeaderTimeout
+	api.Server.ReadTimeout = rc.ReadTimeout
+	api.Server.WriteTimeout = rc.WriteTimeout
+	api.Server.IdleTimeout = rc.IdleTimeout
+	api.Server.MaxHeaderBytes = rc.MaxHeaderBytes
+	api.Engine.MaxMultipartMemory = rc.MaxMultipartMemory
 
 	api.SetNoRoute(func(c *gin.Context) {
-		c.JSON(http.StatusNotFound, gin.H{"code": 0, "message": "Page not found"})
-		return
+		c.JSON(http.StatusNotFound, handle.ErrorBody(c.Request.Context(), http.StatusNotFound, "Page not found"))
 	})
 	cli := NewCliServer(api, nil)
 
 	router := NewRouter(api, cli)
 	router.config = rc
+	router.jobs = jobs.NewManager(rc.JobStore, rc.JobTTL)
+	cli.stdioCommand = router.stdioCommand()
+	cli.shellCommand = router.shellCommand()
+	cli.runScriptCommand = router.runScriptCommand()
+	cli.completionCommand = router.completionCommand()
+	cli.completeCommand = router.completeCommand()
+	cli.docCommand = router.docCommand()
+
+	api.Engine.Use(requestIDMiddleware(rc.RequestIDHeader))
+	if rc.FormatParam != handle.FormatParam {
+		api.Engine.Use(formatParamMiddleware(rc.FormatParam))
+	}
+	if rc.Envelope != nil {
+		api.Engine.Use(envelopeMiddleware(rc.Envelope))
+	}
+	if rc.CORS != nil {
+		api.Engine.Use(corsMiddleware(rc.CORS, router.corsPath))
+	}
+	if rc.MetricsPath != "" {
+		api.Engine.Use(router.metrics.middleware())
+		api.Engine.GET(rc.MetricsPath, router.metrics.handler())
+	}
+	if rc.TraceExporter != nil {
+		router.tracer = trace.NewTracer(rc.TraceExporter)
+		api.Engine.Use(tracingMiddleware(router.tracer))
+	}
+	if rc.JSONRPCPath != "" {
+		api.Engine.POST(rc.JSONRPCPath, append(router.endpointLimits(true), router.rpcHandler())...)
+	}
+	if rc.BatchPath != "" {
+		// sub-requests run with the timeouts of their routes
+		api.Engine.POST(rc.BatchPath, append(router.endpointLimits(false), router.batchHandler())...)
+	}
 
 	return router, nil
 }
 
 func (r *Router) Run() {
 	r.cli.Run()
+	// jobs started with --async finish before the process exits
+	r.jobs.Wait()
 }
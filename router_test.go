@@ -62,32 +62,38 @@ func TestNotFound(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	w := performRequest(r, "GET", "/xxxx")
+	w := performRequest(r, "GET", "/xxxx", header{"X-Request-ID", "req-1"})
 	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.JSONEq(t, `{"code":1,"msg":"Page not found","request_id":"req-1"}`, w.Body.String())
 }
 
-func ExampleRun() {
+func ExampleRouter_Run() {
 	os.Args = []string{"test"}
 	r, _ := New()
 	r.Run()
 
 	//Output:
 	//NAME:
-	//test - A new cli application
+	//    test - A new cli application
 	//
 	//USAGE:
-	//   test [global options] command [command options] [arguments...]
+	//    test [global options] command [command options] [arguments...]
 	//
 	//COMMANDS:
-	//   server, s        start a api server
-	//   tls_server, tls  start a api tls server
-	//   help, h          Shows a list of commands or help for one command
+	//    server, s        start a api server
+	//    tls_server, tls  start a api tls server
+	//    stdio            serve json-rpc requests read line by line from stdin
+	//    shell            open an interactive shell running the commands of the app
+	//    run-script       run the commands of a script file, or of stdin if none is given
+	//    completion       print the completion script of a shell
+	//    doc              generate man pages or a markdown reference of all commands
+	//    help, h          Shows a list of commands or help for one command
 	//
 	//GLOBAL OPTIONS:
-	//   --help, -h  show help (default: false)
+	//    --help, -h  show help (default: false)
 }
 
-func ExampleRunCli() {
+func ExampleRouter_Run_cli() {
 	os.Args = []string{"-", "hello"} // the first string is program name
 	r, _ := New()
 	r.AddCliCommand(&cli.Command{
@@ -103,3 +109,28 @@ func ExampleRunCli() {
 	//Output:
 	//hello world
 }
+
+func TestRequestID(t *testing.T) {
+	r, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var id string
+	r.AddApiRoute("/fail", "GET", "fail api", nil, nil, func(action handle.Action, response handle.Response) {
+		id = action.RequestID()
+		action.Logger().Info("failing")
+		response.SendSimpleFail("failed")
+	})
+
+	w := performRequest(r, "GET", "/fail", header{"X-Request-ID", "abc-123"})
+	assert.Equal(t, "abc-123", id)
+	assert.Equal(t, "abc-123", w.Header().Get("X-Request-ID"))
+	assert.Contains(t, w.Body.String(), `"request_id":"abc-123"`)
+
+	w = performRequest(r, "GET", "/fail")
+	assert.Len(t, id, 32)
+	assert.Equal(t, id, w.Header().Get("X-Request-ID"))
+
+	w = performRequest(r, "GET", "/xxxx", header{"X-Request-ID", "abc-456"})
+	assert.Contains(t, w.Body.String(), `"request_id":"abc-456"`)
+}
@@ -0,0 +1,201 @@
+package acrouter
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+	"github.com/zfs123/go-ac-router/jsonrpc"
+)
+
+// DefaultJSONRPCPath is the path of the json-rpc endpoint if none is given
+const DefaultJSONRPCPath = "/rpc"
+
+// Error codes answered for handler errors, in the range reserved for servers
+const (
+	RPCCodeServerError     = jsonrpc.CodeServerError
+	RPCCodeUnauthorized    = jsonrpc.CodeServerError - 1
+	RPCCodeForbidden       = jsonrpc.CodeServerError - 3
+	RPCCodeNotFound        = jsonrpc.CodeServerError - 4
+	RPCCodeConflict        = jsonrpc.CodeServerError - 9
+	RPCCodeTooManyRequests = jsonrpc.CodeServerError - 29
+)
+
+// Name the route is called by over json-rpc, derived from the path if empty
+func RPCMethod(name string) RouteOption {
+	return func(route *Route) {
+		route.RPCMethod = name
+	}
+}
+
+// Derive the json-rpc method name of a path, /users/:id/orders becomes users.orders
+func rpcMethodName(path string) string {
+	var parts []string
+	for _, segment := range strings.Split(path, "/") {
+		if segment == "" || segment[0] == ':' || segment[0] == '*' {
+			continue
+		}
+		parts = append(parts, segment)
+	}
+	if len(parts) == 0 {
+		return "index"
+	}
+	return strings.Join(parts, ".")
+}
+
+// Register the json-rpc method of route, the http method is appended on conflicts
+func (r *Router) addRPCMethod(route *Route) {
+	if route.HandleFunc == nil {
+		return
+	}
+	if route.RPCMethod == "" {
+		route.RPCMethod = rpcMethodName(route.Path)
+		if _, taken := r.rpcMethods[route.RPCMethod]; taken {
+			route.RPCMethod += "." + strings.ToLower(route.Method)
+		}
+	}
+	r.rpcMethods[route.RPCMethod] = route
+}
+
+// Answer json-rpc calls, single requests and batches, on the configured path
+func (r *Router) rpcHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		body, err := ioutil.ReadAll(c.Request.Body)
+		if err != nil {
+			abortWithError(c, http.StatusBadRequest, "read request body failed")
+			return
+		}
+		parent := c.Request
+		resp := jsonrpc.Handle(c.Request.Context(), body, func(ctx context.Context, method string, params json.RawMessage) (interface{}, *jsonrpc.Error) {
+			return r.callRPC(ctx, method, params, parent)
+		})
+		if resp == nil {
+			c.Status(http.StatusNoContent)
+			return
+		}
+		c.Data(http.StatusOK, "application/json", resp)
+	}
+}
+
+// Call the route of method in process and translate its response
+func (r *Router) callRPC(ctx context.Context, method string, params json.RawMessage, parent *http.Request) (interface{}, *jsonrpc.Error) {
+	route, ok := r.rpcMethods[method]
+	if !ok {
+		return nil, jsonrpc.NewError(jsonrpc.CodeMethodNotFound, "method not found", method)
+	}
+	values, err := rpcValues(params)
+	if err != nil {
+		return nil, jsonrpc.NewError(jsonrpc.CodeInvalidParams, "invalid params", err.Error())
+	}
+	req, err := r.newRouteRequest(ctx, route, values, parent)
+	if err != nil {
+		return nil, jsonrpc.NewError(jsonrpc.CodeInvalidParams, "invalid params", err.Error())
+	}
+	rr := r.dispatch(req)
+	result := decodeBody(rr.body.Bytes())
+	code := rr.status()
+	if code < http.StatusBadRequest {
+		return result, nil
+	}
+	return nil, jsonrpc.NewError(rpcErrorCode(code), errorMessage(code, result), gin.H{"status": code, "body": result})
+}
+
+// Convert named params to the form values the routes bind from
+func rpcValues(params json.RawMessage) (url.Values, error) {
+	values := url.Values{}
+	params = bytes.TrimSpace(params)
+	if len(params) == 0 || string(params) == "null" {
+		return values, nil
+	}
+	if params[0] == '[' {
+		var positional []json.RawMessage
+		if err := json.Unmarshal(params, &positional); err != nil || len(positional) > 0 {
+			return nil, errors.New("params must be an object")
+		}
+		return values, nil
+	}
+	decoder := json.NewDecoder(bytes.NewReader(params))
+	decoder.UseNumber()
+	var named map[string]interface{}
+	if err := decoder.Decode(&named); err != nil {
+		return nil, errors.New("params must be an object")
+	}
+	for name, value := range named {
+		if list, ok := value.([]interface{}); ok {
+			for _, item := range list {
+				values.Add(name, formValue(item))
+			}
+			continue
+		}
+		if value != nil {
+			values.Set(name, formValue(value))
+		}
+	}
+	return values, nil
+}
+
+func formValue(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case bool:
+		return strconv.FormatBool(v)
+	}
+	b, _ := json.Marshal(value)
+	return string(b)
+}
+
+// Decode a json body, other bodies are returned as string
+func decodeBody(body []byte) interface{} {
+	if len(bytes.TrimSpace(body)) == 0 {
+		return nil
+	}
+	var v interface{}
+	if err := json.Unmarshal(body, &v); err != nil {
+		return string(body)
+	}
+	return v
+}
+
+// Map http error statuses to json-rpc error codes
+func rpcErrorCode(status int) int {
+	switch status {
+	case http.StatusBadRequest, http.StatusRequestEntityTooLarge, http.StatusUnprocessableEntity:
+		return jsonrpc.CodeInvalidParams
+	case http.StatusUnauthorized:
+		return RPCCodeUnauthorized
+	case http.StatusForbidden:
+		return RPCCodeForbidden
+	case http.StatusNotFound:
+		return RPCCodeNotFound
+	case http.StatusConflict:
+		return RPCCodeConflict
+	case http.StatusTooManyRequests:
+		return RPCCodeTooManyRequests
+	}
+	return RPCCodeServerError
+}
+
+// Take the message of an error envelope, the status text otherwise
+func errorMessage(status int, body interface{}) string {
+	if m, ok := body.(map[string]interface{}); ok {
+		if e, ok := m["error"].(map[string]interface{}); ok {
+			m = e
+		}
+		for _, key := range []string{"msg", "message"} {
+			if msg, ok := m[key].(string); ok && msg != "" {
+				return msg
+			}
+		}
+	}
+	return strings.ToLower(http.StatusText(status))
+}
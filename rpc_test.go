@@ -0,0 +1,133 @@
+package acrouter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/zfs123/go-ac-router/auth"
+	"github.com/zfs123/go-ac-router/handle"
+)
+
+type greetParams struct {
+	Name  string   `form:"name" binding:"required"`
+	Times int      `form:"times"`
+	Tags  []string `form:"tags"`
+}
+
+func performRPC(r *Router, body string, headers ...header) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", DefaultJSONRPCPath, strings.NewReader(body))
+	for _, h := range headers {
+		req.Header.Add(h.Key, h.Value)
+	}
+	w := httptest.NewRecorder()
+	r.api.Engine.ServeHTTP(w, req)
+	return w
+}
+
+func newRPCRouter(t *testing.T) *Router {
+	r, err := New(JSONRPC(""), Authentication(auth.NewAPIKeyAuthenticator(map[string]string{"secret": "alice"})))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.AddApiRoute("/greet", "POST", "greet someone", &greetParams{}, nil, func(action handle.Action, response handle.Response) {
+		var params greetParams
+		if err := action.ShouldBind(&params); err != nil {
+			response.Response(http.StatusBadRequest, gin.H{"code": 1, "msg": err.Error()})
+			return
+		}
+		response.Response(http.StatusOK, gin.H{"greeting": "hello " + params.Name, "times": params.Times, "tags": params.Tags})
+	}, Public())
+	r.AddApiRoute("/users/:id", "GET", "show user", nil, nil, func(action handle.Action, response handle.Response) {
+		response.Response(http.StatusOK, gin.H{"id": action.(*handle.ApiAction).C.Param("id"), "by": action.Principal().Name})
+	})
+	return r
+}
+
+func TestJSONRPCCall(t *testing.T) {
+	r := newRPCRouter(t)
+
+	w := performRPC(r, `{"jsonrpc":"2.0","method":"greet","params":{"name":"bob","times":2,"tags":["a","b"]},"id":1}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"jsonrpc":"2.0","result":{"greeting":"hello bob","times":2,"tags":["a","b"]},"id":1}`, w.Body.String())
+
+	w = performRPC(r, `{"jsonrpc":"2.0","method":"users","params":{"id":"42"},"id":"a"}`, header{"X-API-Key", "secret"})
+	assert.JSONEq(t, `{"jsonrpc":"2.0","result":{"id":"42","by":"alice"},"id":"a"}`, w.Body.String())
+
+	w = performRPC(r, `{"jsonrpc":"2.0","method":"users","params":{"id":"42"},"id":2}`)
+	assert.Contains(t, w.Body.String(), `"code":-32001`)
+
+	w = performRPC(r, `{"jsonrpc":"2.0","method":"greet","params":{},"id":3}`)
+	assert.Contains(t, w.Body.String(), `"code":-32602`)
+}
+
+func TestJSONRPCErrors(t *testing.T) {
+	r := newRPCRouter(t)
+	cases := []struct {
+		body string
+		code string
+	}{
+		{`{"jsonrpc":"2.0","method":"greet",`, `"code":-32700`},
+		{`{"jsonrpc":"1.0","method":"greet","id":1}`, `"code":-32600`},
+		{`[]`, `"code":-32600`},
+		{`{"jsonrpc":"2.0","method":"unknown","id":1}`, `"code":-32601`},
+		{`{"jsonrpc":"2.0","method":"greet","params":["bob"],"id":1}`, `"code":-32602`},
+		{`{"jsonrpc":"2.0","method":"users","id":1}`, `"code":-32602`},
+	}
+	for _, c := range cases {
+		assert.Contains(t, performRPC(r, c.body).Body.String(), c.code, c.body)
+	}
+}
+
+func TestJSONRPCBatch(t *testing.T) {
+	r := newRPCRouter(t)
+
+	w := performRPC(r, `[
+		{"jsonrpc":"2.0","method":"greet","params":{"name":"a"},"id":1},
+		{"jsonrpc":"2.0","method":"greet","params":{"name":"b"}},
+		{"jsonrpc":"2.0","method":"unknown","id":2},
+		1
+	]`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `[
+		{"jsonrpc":"2.0","result":{"greeting":"hello a","times":0,"tags":null},"id":1},
+		{"jsonrpc":"2.0","error":{"code":-32601,"message":"method not found","data":"unknown"},"id":2},
+		{"jsonrpc":"2.0","error":{"code":-32600,"message":"invalid request"},"id":null}
+	]`, w.Body.String())
+
+	w = performRPC(r, `[{"jsonrpc":"2.0","method":"greet","params":{"name":"a"}}]`)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+}
+
+func TestRPCMethodName(t *testing.T) {
+	assert.Equal(t, "users.orders", rpcMethodName("/users/:id/orders"))
+	assert.Equal(t, "index", rpcMethodName("/"))
+
+	r, _ := New()
+	r.AddApiRoute("/users", "GET", "list users", nil, nil, func(handle.Action, handle.Response) {})
+	r.AddApiRoute("/users", "POST", "create user", nil, nil, func(handle.Action, handle.Response) {})
+	r.AddApiRoute("/me", "GET", "show me", nil, nil, func(handle.Action, handle.Response) {}, RPCMethod("users.me"))
+	assert.Equal(t, "users", r.Routes()[0].RPCMethod)
+	assert.Equal(t, "users.post", r.Routes()[1].RPCMethod)
+	assert.Equal(t, "users.me", r.Routes()[2].RPCMethod)
+}
+
+func TestJSONRPCLimits(t *testing.T) {
+	r, err := New(JSONRPC(""), RequestLimits(http.DefaultMaxHeaderBytes, 128), HandlerTimeout(50*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.AddApiRoute("/slow", "POST", "slow api", nil, nil, func(action handle.Action, response handle.Response) {
+		<-action.Context().Done()
+	}, Timeout(time.Minute))
+
+	w := performRPC(r, `{"jsonrpc":"2.0","method":"slow","params":{"pad":"`+strings.Repeat("x", 200)+`"},"id":1}`)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+
+	w = performRPC(r, `{"jsonrpc":"2.0","method":"slow","id":1}`)
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+}
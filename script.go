@@ -0,0 +1,382 @@
+package acrouter
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/urfave/cli/v2"
+	"gopkg.in/yaml.v2"
+)
+
+// scriptStep is one command of a script and its outcome
+type scriptStep struct {
+	ID      string   `json:"id,omitempty" yaml:"id"`
+	Command string   `json:"command" yaml:"command"`
+	Args    []string `json:"args,omitempty" yaml:"args"`
+
+	// status and data responded by the route, exitCode is non zero on error statuses
+	code     int
+	data     interface{}
+	exitCode int
+}
+
+type scriptStepKey struct{}
+
+// Record the outcome of the command run with ctx in step
+func contextWithScriptStep(ctx context.Context, step *scriptStep) context.Context {
+	return context.WithValue(ctx, scriptStepKey{}, step)
+}
+
+func scriptStepFromContext(ctx context.Context) *scriptStep {
+	step, _ := ctx.Value(scriptStepKey{}).(*scriptStep)
+	return step
+}
+
+// scriptResult is printed per step with --format json
+type scriptResult struct {
+	Step     int         `json:"step"`
+	ID       string      `json:"id,omitempty"`
+	Command  string      `json:"command"`
+	Args     []string    `json:"args,omitempty"`
+	Status   string      `json:"status"`
+	ExitCode int         `json:"exit_code"`
+	Code     int         `json:"code,omitempty"`
+	Data     interface{} `json:"data,omitempty"`
+	Output   string      `json:"output,omitempty"`
+	Error    string      `json:"error,omitempty"`
+}
+
+// scriptSummary is printed once all steps ran
+type scriptSummary struct {
+	Steps     int `json:"steps"`
+	Succeeded int `json:"succeeded"`
+	Failed    int `json:"failed"`
+	Skipped   int `json:"skipped"`
+}
+
+// Command running the commands of a script file or of stdin in one process
+//
+// A script is a list of command lines, or a json or yaml list of objects
+// with command, args and an optional id. ${name} is replaced by a variable
+// given with --var, ${step.path} by a field of the data responded by an
+// earlier step, referenced by its id, its number or "last".
+func (r *Router) runScriptCommand() *cli.Command {
+	return &cli.Command{
+		Name:      "run-script",
+		Usage:     "run the commands of a script file, or of stdin if none is given",
+		ArgsUsage: "[file]",
+		Flags: []cli.Flag{
+			&cli.BoolFlag{Name: "continue", Usage: "run the remaining steps after a step failed"},
+			&cli.StringFlag{Name: "format", Usage: "output of each step, text or json", Value: "text"},
+			&cli.StringSliceFlag{Name: "var", Usage: "variable available to the script, as name=value"},
+		},
+		Action: func(c *cli.Context) error {
+			format := c.String("format")
+			if format != "text" && format != "json" {
+				return cli.Exit("format must be text or json", 1)
+			}
+			vars := map[string]string{}
+			for _, v := range c.StringSlice("var") {
+				i := strings.Index(v, "=")
+				if i <= 0 {
+					return cli.Exit("invalid variable "+v, 1)
+				}
+				vars[v[:i]] = v[i+1:]
+			}
+			script, err := readScript(c)
+			if err != nil {
+				return cli.Exit(err.Error(), 1)
+			}
+			steps, err := parseScript(script)
+			if err != nil {
+				return cli.Exit(err.Error(), 1)
+			}
+			run := &scriptRun{app: c.App, format: format, vars: vars, steps: steps}
+			summary := run.execute(c.Context, c.Bool("continue"))
+			run.printSummary(summary)
+			if summary.Failed > 0 {
+				return cli.Exit("", 1)
+			}
+			return nil
+		},
+	}
+}
+
+func readScript(c *cli.Context) ([]byte, error) {
+	name := c.Args().First()
+	if name == "" || name == "-" {
+		b, err := ioutil.ReadAll(c.App.Reader)
+		return b, errors.Wrap(err, "read stdin")
+	}
+	b, err := ioutil.ReadFile(name)
+	return b, errors.Wrap(err, "read script")
+}
+
+// Parse a json list, a yaml list or command lines
+func parseScript(script []byte) ([]*scriptStep, error) {
+	var steps []*scriptStep
+	trimmed := bytes.TrimSpace(script)
+	switch {
+	case bytes.HasPrefix(trimmed, []byte("[")):
+		if err := json.Unmarshal(trimmed, &steps); err != nil {
+			return nil, errors.Wrap(err, "parse json script")
+		}
+	case yamlList(script):
+		if err := yaml.Unmarshal(script, &steps); err != nil {
+			return nil, errors.Wrap(err, "parse yaml script")
+		}
+	default:
+		scanner := bufio.NewScanner(bytes.NewReader(script))
+		text := ""
+		for n := 1; scanner.Scan(); n++ {
+			line := strings.TrimSpace(scanner.Text())
+			if text == "" && (line == "" || strings.HasPrefix(line, "#")) {
+				continue
+			}
+			if strings.HasSuffix(line, "\\") {
+				text += strings.TrimSuffix(line, "\\") + " "
+				continue
+			}
+			text += line
+			args, complete := splitArgs(text)
+			if !complete {
+				text += "\n"
+				continue
+			}
+			text = ""
+			steps = append(steps, &scriptStep{Command: args[0], Args: args[1:]})
+		}
+		if text != "" {
+			return nil, errors.New("unterminated quote at the end of the script")
+		}
+	}
+	for i, step := range steps {
+		if step == nil || step.Command == "" {
+			return nil, errors.Errorf("step %d has no command", i+1)
+		}
+	}
+	return steps, nil
+}
+
+// Check whether the first statement of the script is a yaml list item
+func yamlList(script []byte) bool {
+	scanner := bufio.NewScanner(bytes.NewReader(script))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || line == "---" {
+			continue
+		}
+		return line == "-" || strings.HasPrefix(line, "- ")
+	}
+	return false
+}
+
+// scriptRun executes the steps of a script
+type scriptRun struct {
+	app    *cli.App
+	format string
+	vars   map[string]string
+	steps  []*scriptStep
+}
+
+// Run the steps in order, stopping at the first failure unless keepGoing
+func (run *scriptRun) execute(ctx context.Context, keepGoing bool) scriptSummary {
+	summary := scriptSummary{Steps: len(run.steps)}
+	for i := range run.steps {
+		if ctx.Err() != nil || (summary.Failed > 0 && !keepGoing) {
+			summary.Skipped = len(run.steps) - i
+			break
+		}
+		result := run.executeStep(ctx, i)
+		run.printResult(result)
+		if result.Status == "succeeded" {
+			summary.Succeeded++
+		} else {
+			summary.Failed++
+		}
+	}
+	return summary
+}
+
+func (run *scriptRun) executeStep(ctx context.Context, i int) scriptResult {
+	step := run.steps[i]
+	result := scriptResult{Step: i + 1, ID: step.ID, Command: step.Command, Status: "failed", ExitCode: 1}
+	args, err := run.expand(append([]string{step.Command}, step.Args...), i)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	result.Command, result.Args = args[0], args[1:]
+	switch command := run.app.Command(args[0]); {
+	case command == nil:
+		result.Error = "unknown command " + args[0]
+		return result
+	case command.Name == "shell" || command.Name == "run-script":
+		result.Error = "command " + command.Name + " can not run in a script"
+		return result
+	}
+
+	// capture the output of the step unless it is printed as is
+	writer := run.app.Writer
+	output := &bytes.Buffer{}
+	if run.format == "json" {
+		run.app.Writer = output
+	}
+	err = runCommand(contextWithScriptStep(ctx, step), run.app, args)
+	run.app.Writer = writer
+
+	result.Output = output.String()
+	result.Code, result.Data = step.code, step.data
+	if err != nil {
+		result.Error = err.Error()
+		if exit, ok := err.(cli.ExitCoder); ok {
+			result.ExitCode = exit.ExitCode()
+		}
+		return result
+	}
+	result.ExitCode = step.exitCode
+	if step.exitCode == 0 {
+		result.Status = "succeeded"
+	}
+	return result
+}
+
+var scriptVariable = regexp.MustCompile(`\$\{([^}]+)\}`)
+
+// Replace the variables in args, step is the index of the running step
+func (run *scriptRun) expand(args []string, step int) ([]string, error) {
+	expanded := make([]string, len(args))
+	for i, arg := range args {
+		var err error
+		expanded[i] = scriptVariable.ReplaceAllStringFunc(arg, func(match string) string {
+			value, e := run.lookup(match[2:len(match)-1], step)
+			if e != nil && err == nil {
+				err = e
+			}
+			return value
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return expanded, nil
+}
+
+// Resolve a variable or a field of the data of an earlier step
+func (run *scriptRun) lookup(name string, step int) (string, error) {
+	if value, ok := run.vars[name]; ok {
+		return value, nil
+	}
+	parts := strings.Split(name, ".")
+	ref := run.findStep(parts[0], step)
+	if ref == nil {
+		return "", errors.Errorf("unknown variable %s", name)
+	}
+	value, err := dataPath(ref.data, parts[1:])
+	if err != nil {
+		return "", errors.Wrapf(err, "variable %s", name)
+	}
+	if s, ok := value.(string); ok {
+		return s, nil
+	}
+	b, _ := json.Marshal(value)
+	return string(b), nil
+}
+
+// Find an earlier step by id, number or "last"
+func (run *scriptRun) findStep(ref string, step int) *scriptStep {
+	if ref == "last" {
+		if step == 0 {
+			return nil
+		}
+		return run.steps[step-1]
+	}
+	if n, err := strconv.Atoi(ref); err == nil {
+		if n < 1 || n > step {
+			return nil
+		}
+		return run.steps[n-1]
+	}
+	for _, s := range run.steps[:step] {
+		if s.ID == ref {
+			return s
+		}
+	}
+	return nil
+}
+
+// Walk a path of object keys and list indexes through data
+func dataPath(data interface{}, path []string) (interface{}, error) {
+	if len(path) == 0 {
+		return data, nil
+	}
+	// convert structs to the generic form json decodes into
+	b, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	var value interface{}
+	if err := json.Unmarshal(b, &value); err != nil {
+		return nil, err
+	}
+	for _, key := range path {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			field, ok := v[key]
+			if !ok {
+				return nil, errors.Errorf("no field %s", key)
+			}
+			value = field
+		case []interface{}:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(v) {
+				return nil, errors.Errorf("no index %s", key)
+			}
+			value = v[i]
+		default:
+			return nil, errors.Errorf("no field %s", key)
+		}
+	}
+	return value, nil
+}
+
+func (run *scriptRun) printResult(result scriptResult) {
+	if run.format == "json" {
+		writeJSONLine(run.app.Writer, result)
+		return
+	}
+	if result.Status != "succeeded" {
+		msg := result.Error
+		if msg == "" {
+			msg = "exit code " + strconv.Itoa(result.ExitCode)
+		}
+		_, _ = fmt.Fprintf(run.app.ErrWriter, "step %d (%s) failed: %s\n", result.Step, result.Command, msg)
+	}
+}
+
+func (run *scriptRun) printSummary(summary scriptSummary) {
+	if run.format == "json" {
+		writeJSONLine(run.app.Writer, map[string]scriptSummary{"summary": summary})
+		return
+	}
+	_, _ = fmt.Fprintf(run.app.Writer, "%d steps, %d succeeded, %d failed, %d skipped\n",
+		summary.Steps, summary.Succeeded, summary.Failed, summary.Skipped)
+}
+
+func writeJSONLine(w io.Writer, v interface{}) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		_, _ = fmt.Fprintln(w, err)
+		return
+	}
+	_, _ = w.Write(append(b, '\n'))
+}
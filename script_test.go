@@ -0,0 +1,91 @@
+package acrouter
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/urfave/cli/v2"
+	"github.com/zfs123/go-ac-router/handle"
+)
+
+type userParams struct {
+	ID   string `form:"id"`
+	Name string `form:"name"`
+}
+
+func runScript(t *testing.T, script string, args ...string) (string, string) {
+	os.Args = append([]string{"-", "run-script"}, args...)
+	r, _ := New()
+	out, errOut := &bytes.Buffer{}, &bytes.Buffer{}
+	r.cli.App.Writer = out
+	r.cli.App.ErrWriter = errOut
+	r.cli.App.Reader = strings.NewReader(script)
+	r.cli.App.ExitErrHandler = func(*cli.Context, error) {}
+	r.AddMultiRoute("/users/create", "POST", "create user", &userParams{}, nil, func(action handle.Action, response handle.Response) {
+		response.Response(http.StatusOK, map[string]interface{}{"id": "u1", "name": action.String("name")})
+	})
+	r.AddMultiRoute("/users/show", "GET", "show user", &userParams{}, nil, func(action handle.Action, response handle.Response) {
+		if action.String("id") != "u1" {
+			response.Response(http.StatusNotFound, map[string]string{"msg": "no user " + action.String("id")})
+			return
+		}
+		response.SendSimpleOk("user u1 " + action.String("name"))
+	})
+	r.Run()
+	return out.String(), errOut.String()
+}
+
+func TestRunScriptLines(t *testing.T) {
+	out, errOut := runScript(t, `
+# create a user and show it
+users_create --name bob
+users_show --id ${last.id} \
+  --name "${1.name} ${who}"
+users_show --id missing
+users_show --id u1
+`, "--var", "who=smith")
+
+	assert.Equal(t, `code 200,msg {"id":"u1","name":"bob"}
+user u1 bob smith
+code 404,msg {"msg":"no user missing"}
+4 steps, 2 succeeded, 1 failed, 1 skipped
+`, out)
+	assert.Equal(t, "step 3 (users_show) failed: exit code 1\n", errOut)
+}
+
+func TestRunScriptJSON(t *testing.T) {
+	out, _ := runScript(t, `[
+		{"id": "bob", "command": "users_create", "args": ["--name", "bob"]},
+		{"command": "users_show", "args": ["--id", "${bob.missing}"]},
+		{"command": "unknown"},
+		{"command": "users_show", "args": ["--id", "${bob.id}"]}
+	]`, "--format", "json", "--continue")
+
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	assert.Len(t, lines, 5)
+	var results []map[string]interface{}
+	for _, line := range lines {
+		var result map[string]interface{}
+		assert.NoError(t, json.Unmarshal([]byte(line), &result))
+		results = append(results, result)
+	}
+	assert.Equal(t, "succeeded", results[0]["status"])
+	assert.Equal(t, map[string]interface{}{"id": "u1", "name": "bob"}, results[0]["data"])
+	assert.Equal(t, "variable bob.missing: no field missing", results[1]["error"])
+	assert.Equal(t, "unknown command unknown", results[2]["error"])
+	assert.Equal(t, "user u1 \n", results[3]["output"])
+	assert.Equal(t, map[string]interface{}{"steps": 4.0, "succeeded": 2.0, "failed": 2.0, "skipped": 0.0}, results[4]["summary"])
+}
+
+func TestParseYAMLScript(t *testing.T) {
+	steps, err := parseScript([]byte("# setup\n- id: a\n  command: users_create\n  args: [--name, bob]\n- command: users_show\n"))
+	assert.NoError(t, err)
+	assert.Len(t, steps, 2)
+	assert.Equal(t, "a", steps[0].ID)
+	assert.Equal(t, []string{"--name", "bob"}, steps[0].Args)
+}
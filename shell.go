@@ -0,0 +1,381 @@
+package acrouter
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+
+	"github.com/peterh/liner"
+	"github.com/urfave/cli/v2"
+	"github.com/zfs123/go-ac-router/utils"
+)
+
+// Prompts of the shell, the second one asks for the rest of a multi-line command
+const (
+	shellPrompt         = "> "
+	shellContinuePrompt = "... "
+)
+
+// Commands handled by the shell itself
+var shellBuiltins = []string{"set", "unset", "vars", "exit"}
+
+// lineReader reads the lines typed in the shell
+type lineReader interface {
+	Prompt(prompt string) (string, error)
+	AppendHistory(line string)
+	Close() error
+}
+
+// Command opening an interactive prompt dispatching to all commands of the app
+//
+// Session variables set with "set name value" are passed as --name to every
+// command having such a flag, unless the flag is given on the line. A line
+// ending with a backslash or an open quote continues on the next one.
+func (r *Router) shellCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "shell",
+		Usage: "open an interactive shell running the commands of the app",
+		Flags: []cli.Flag{
+			&cli.StringFlag{Name: "history", Usage: "file the history is kept in, disabled if empty", Value: defaultHistoryFile(), TakesFile: true},
+		},
+		Action: func(c *cli.Context) error {
+			s := &shell{app: c.App, ctx: utils.Detach(c.Context), vars: map[string]string{}}
+			return s.run(s.newLineReader(c.String("history")))
+		},
+	}
+}
+
+func defaultHistoryFile() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, "."+filepath.Base(os.Args[0])+"_history")
+}
+
+// shell is the state of an interactive session
+type shell struct {
+	app  *cli.App
+	ctx  context.Context
+	vars map[string]string
+}
+
+// Read from a terminal with line editing, or plain lines from other readers
+func (s *shell) newLineReader(history string) lineReader {
+	if f, ok := s.app.Reader.(*os.File); !ok || f != os.Stdin || !utils.IsTerminal(os.Stdin) {
+		return &plainLineReader{scanner: bufio.NewScanner(s.app.Reader)}
+	}
+	state := liner.NewLiner()
+	state.SetCtrlCAborts(true)
+	state.SetTabCompletionStyle(liner.TabPrints)
+	state.SetCompleter(s.complete)
+	if history != "" {
+		if f, err := os.Open(history); err == nil {
+			_, _ = state.ReadHistory(f)
+			_ = f.Close()
+		}
+	}
+	return &terminalLineReader{State: state, history: history}
+}
+
+// Read and run commands until the input ends or exit is typed
+func (s *shell) run(reader lineReader) error {
+	defer reader.Close()
+	for {
+		args, line, err := s.readCommand(reader)
+		if err == io.EOF {
+			return nil
+		}
+		if err == liner.ErrPromptAborted {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if len(args) == 0 {
+			continue
+		}
+		reader.AppendHistory(line)
+		if args[0] == "exit" {
+			return nil
+		}
+		if err := s.execute(args); err != nil {
+			_, _ = fmt.Fprintln(s.app.ErrWriter, err)
+		}
+	}
+}
+
+// Read a command that may span several lines
+func (s *shell) readCommand(reader lineReader) ([]string, string, error) {
+	prompt := shellPrompt
+	var text string
+	for {
+		line, err := reader.Prompt(prompt)
+		if err != nil {
+			if err == io.EOF && text != "" {
+				return nil, "", fmt.Errorf("unexpected end of input")
+			}
+			return nil, "", err
+		}
+		if strings.HasSuffix(line, "\\") {
+			text += strings.TrimSuffix(line, "\\") + " "
+			prompt = shellContinuePrompt
+			continue
+		}
+		text += line
+		args, complete := splitArgs(text)
+		if complete {
+			return args, text, nil
+		}
+		text += "\n"
+		prompt = shellContinuePrompt
+	}
+}
+
+// Run a builtin or a command of the app
+func (s *shell) execute(args []string) error {
+	switch args[0] {
+	case "set":
+		if len(args) != 3 {
+			return fmt.Errorf("usage: set <name> <value>")
+		}
+		s.vars[args[1]] = args[2]
+		return nil
+	case "unset":
+		if len(args) != 2 {
+			return fmt.Errorf("usage: unset <name>")
+		}
+		delete(s.vars, args[1])
+		return nil
+	case "vars":
+		for _, name := range s.varNames() {
+			_, _ = fmt.Fprintf(s.app.Writer, "%s=%s\n", name, s.vars[name])
+		}
+		return nil
+	case "shell":
+		return fmt.Errorf("already in a shell")
+	}
+	if command := s.app.Command(args[0]); command != nil {
+		args = append(args[:1], append(s.sessionFlags(command, args[1:]), args[1:]...)...)
+	}
+	return s.dispatch(args)
+}
+
+// Run a command of the app, interrupts only cancel the running command
+func (s *shell) dispatch(args []string) error {
+	ctx, cancel := context.WithCancel(s.ctx)
+	defer cancel()
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+	go func() {
+		select {
+		case <-signals:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	return runCommand(ctx, s.app, args)
+}
+
+// Run a command of app without letting it exit the process
+func runCommand(ctx context.Context, app *cli.App, args []string) (err error) {
+	// the app exits the process on errors it reports, return them instead
+	exitHandler := app.ExitErrHandler
+	app.ExitErrHandler = func(*cli.Context, error) {}
+	defer func() {
+		app.ExitErrHandler = exitHandler
+		if p := recover(); p != nil {
+			err = fmt.Errorf("%v", p)
+		}
+	}()
+	return app.RunContext(ctx, append([]string{app.Name}, args...))
+}
+
+// Flags filled from session variables the command has and args do not set
+func (s *shell) sessionFlags(command *cli.Command, args []string) []string {
+	var flags []string
+	for _, name := range s.varNames() {
+		if !hasFlag(command, name) || flagGiven(args, name) {
+			continue
+		}
+		flags = append(flags, "--"+name+"="+s.vars[name])
+	}
+	return flags
+}
+
+func (s *shell) varNames() []string {
+	names := make([]string, 0, len(s.vars))
+	for name := range s.vars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func hasFlag(command *cli.Command, name string) bool {
+	for _, flag := range command.Flags {
+		for _, n := range flag.Names() {
+			if n == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func flagGiven(args []string, name string) bool {
+	for _, arg := range args {
+		arg = strings.TrimLeft(arg, "-")
+		if arg == name || strings.HasPrefix(arg, name+"=") {
+			return true
+		}
+	}
+	return false
+}
+
+// Complete command names first, then the flags of the command
+func (s *shell) complete(line string) []string {
+	args, _ := splitArgs(line)
+	if len(args) == 0 || (len(args) == 1 && !strings.HasSuffix(line, " ")) {
+		prefix := ""
+		if len(args) == 1 {
+			prefix = args[0]
+		}
+		return matching(s.commandNames(), "", prefix)
+	}
+	command := s.app.Command(args[0])
+	if command == nil {
+		return nil
+	}
+	current := ""
+	if !strings.HasSuffix(line, " ") {
+		current = args[len(args)-1]
+	}
+	if current != "" && !strings.HasPrefix(current, "-") {
+		return nil
+	}
+	var flags []string
+	for _, flag := range command.Flags {
+		flags = append(flags, "--"+flag.Names()[0])
+	}
+	return matching(flags, strings.TrimSuffix(line, current), current)
+}
+
+func (s *shell) commandNames() []string {
+	seen := map[string]bool{}
+	names := append([]string(nil), shellBuiltins...)
+	for _, command := range s.app.Commands {
+		if command.Hidden || command.Name == "shell" {
+			continue
+		}
+		// aliases of route commands often equal their name
+		for _, name := range command.Names() {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Candidates starting with prefix, each completing the line head
+func matching(candidates []string, head, prefix string) []string {
+	var lines []string
+	for _, candidate := range candidates {
+		if strings.HasPrefix(candidate, prefix) {
+			lines = append(lines, head+candidate+" ")
+		}
+	}
+	return lines
+}
+
+// Split a line into arguments like a shell does, complete is false if a quote is open
+func splitArgs(line string) (args []string, complete bool) {
+	var (
+		current strings.Builder
+		inArg   bool
+		quote   rune
+		escaped bool
+	)
+	for _, ch := range line {
+		switch {
+		case escaped:
+			current.WriteRune(ch)
+			escaped = false
+		case ch == '\\' && quote != '\'':
+			escaped = true
+			inArg = true
+		case quote != 0:
+			if ch == quote {
+				quote = 0
+			} else {
+				current.WriteRune(ch)
+			}
+		case ch == '"' || ch == '\'':
+			quote = ch
+			inArg = true
+		case ch == ' ' || ch == '\t' || ch == '\n':
+			if inArg {
+				args = append(args, current.String())
+				current.Reset()
+				inArg = false
+			}
+		default:
+			current.WriteRune(ch)
+			inArg = true
+		}
+	}
+	if inArg {
+		args = append(args, current.String())
+	}
+	return args, quote == 0 && !escaped
+}
+
+// terminalLineReader edits lines on a terminal and keeps the history in a file
+type terminalLineReader struct {
+	*liner.State
+	history string
+}
+
+func (t *terminalLineReader) Close() error {
+	if t.history != "" {
+		// the history may hold secrets typed on the command line
+		if f, err := os.OpenFile(t.history, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600); err == nil {
+			_, _ = t.WriteHistory(f)
+			_ = f.Close()
+		}
+	}
+	return t.State.Close()
+}
+
+// plainLineReader reads lines from input that is not a terminal, without prompts
+type plainLineReader struct {
+	scanner *bufio.Scanner
+}
+
+func (p *plainLineReader) Prompt(string) (string, error) {
+	if !p.scanner.Scan() {
+		if err := p.scanner.Err(); err != nil {
+			return "", err
+		}
+		return "", io.EOF
+	}
+	return p.scanner.Text(), nil
+}
+
+func (p *plainLineReader) AppendHistory(string) {}
+
+func (p *plainLineReader) Close() error {
+	return nil
+}
@@ -0,0 +1,58 @@
+package acrouter
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zfs123/go-ac-router/handle"
+)
+
+func TestShellCommand(t *testing.T) {
+	os.Args = []string{"-", "shell", "--history", ""}
+	r, _ := New()
+	out := &bytes.Buffer{}
+	r.cli.App.Writer = out
+	r.cli.App.ErrWriter = out
+	r.cli.App.Reader = strings.NewReader(strings.Join([]string{
+		`set name bob`,
+		`greet`,
+		`greet --name "alice smith" \`,
+		`  --times 2`,
+		`greet --name 'multi`,
+		`line'`,
+		`vars`,
+		`unset name`,
+		`greet --bogus`,
+		`exit`,
+		`greet`,
+	}, "\n"))
+	r.AddMultiRoute("/greet", "POST", "greet someone", &greetParams{}, nil, func(action handle.Action, response handle.Response) {
+		_, _ = fmt.Fprintf(out, "hello %s %d\n", action.String("name"), action.Int("times"))
+	})
+	r.Run()
+
+	assert.Contains(t, out.String(), "hello bob 0\nhello alice smith 2\nhello multi\nline 0\nname=bob\n")
+	assert.Contains(t, out.String(), "flag provided but not defined: -bogus")
+	assert.Equal(t, 3, strings.Count(out.String(), "hello"))
+}
+
+func TestSplitArgs(t *testing.T) {
+	args, complete := splitArgs(`a "b c" 'd\e' f\ g`)
+	assert.True(t, complete)
+	assert.Equal(t, []string{"a", "b c", `d\e`, "f g"}, args)
+	_, complete = splitArgs(`a "b`)
+	assert.False(t, complete)
+}
+
+func TestShellComplete(t *testing.T) {
+	r, _ := New()
+	r.AddMultiRoute("/greet", "POST", "greet someone", &greetParams{}, nil, func(handle.Action, handle.Response) {})
+	s := &shell{app: r.cli.App}
+	assert.Equal(t, []string{"greet "}, s.complete("gr"))
+	assert.Equal(t, []string{"greet --times "}, s.complete("greet --ti"))
+	assert.Len(t, s.complete("greet "), 3)
+}
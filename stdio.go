@@ -0,0 +1,104 @@
+package acrouter
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/urfave/cli/v2"
+	"github.com/zfs123/go-ac-router/jsonrpc"
+)
+
+// Command serving json-rpc over stdin and stdout, one message per line
+//
+// Calls are handled concurrently, responses are written as they finish and
+// matched to their request by id. The command returns at the end of stdin
+// once every call finished.
+func (r *Router) stdioCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "stdio",
+		Usage: "serve json-rpc requests read line by line from stdin",
+		Flags: []cli.Flag{
+			&cli.StringSliceFlag{Name: "header", Usage: "header sent with every call, as \"Name: value\""},
+		},
+		Action: func(c *cli.Context) error {
+			parent := &http.Request{Header: http.Header{}}
+			for _, h := range c.StringSlice("header") {
+				i := strings.Index(h, ":")
+				if i <= 0 {
+					return cli.Exit("invalid header "+h, 1)
+				}
+				parent.Header.Add(strings.TrimSpace(h[:i]), strings.TrimSpace(h[i+1:]))
+			}
+			return r.serveStdio(c.Context, c.App.Reader, c.App.Writer, parent)
+		},
+	}
+}
+
+// Serve json-rpc messages read from in until it ends or ctx is done
+func (r *Router) serveStdio(ctx context.Context, in io.Reader, out io.Writer, parent *http.Request) error {
+	var (
+		mu sync.Mutex
+		wg sync.WaitGroup
+	)
+	defer wg.Wait()
+	handler := func(ctx context.Context, method string, params json.RawMessage) (interface{}, *jsonrpc.Error) {
+		return r.callRPC(ctx, method, params, parent)
+	}
+
+	lines := make(chan []byte)
+	readErr := make(chan error, 1)
+	go func() {
+		defer close(lines)
+		reader := bufio.NewReader(in)
+		for {
+			line, err := reader.ReadBytes('\n')
+			if len(bytes.TrimSpace(line)) > 0 {
+				select {
+				case lines <- line:
+				case <-ctx.Done():
+					return
+				}
+			}
+			if err != nil {
+				if err != io.EOF {
+					readErr <- errors.Wrap(err, "read stdin")
+				}
+				return
+			}
+		}
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case line, ok := <-lines:
+			if !ok {
+				select {
+				case err := <-readErr:
+					return err
+				default:
+					return nil
+				}
+			}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				resp := jsonrpc.Handle(ctx, line, handler)
+				if resp == nil {
+					return
+				}
+				mu.Lock()
+				defer mu.Unlock()
+				_, _ = out.Write(append(resp, '\n'))
+			}()
+		}
+	}
+}
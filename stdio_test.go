@@ -0,0 +1,42 @@
+package acrouter
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStdioCommand(t *testing.T) {
+	os.Args = []string{"-", "stdio", "--header", "X-API-Key: secret"}
+	r := newRPCRouter(t)
+	out := &bytes.Buffer{}
+	r.cli.App.Writer = out
+	r.cli.App.Reader = strings.NewReader(strings.Join([]string{
+		`{"jsonrpc":"2.0","method":"greet","params":{"name":"bob"},"id":1}`,
+		``,
+		`{"jsonrpc":"2.0","method":"greet","params":{"name":"eve"}}`,
+		`{"jsonrpc":"2.0","method":"users","params":{"id":"7"},"id":2}`,
+		`not json`,
+	}, "\n"))
+	r.Run()
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	assert.Len(t, lines, 3)
+	results := map[string]string{}
+	for _, line := range lines {
+		var resp struct {
+			ID     json.RawMessage `json:"id"`
+			Result json.RawMessage `json:"result"`
+			Error  json.RawMessage `json:"error"`
+		}
+		assert.NoError(t, json.Unmarshal([]byte(line), &resp))
+		results[string(resp.ID)] = string(resp.Result) + string(resp.Error)
+	}
+	assert.Equal(t, `{"greeting":"hello bob","tags":null,"times":0}`, results["1"])
+	assert.Equal(t, `{"by":"alice","id":"7"}`, results["2"])
+	assert.Contains(t, results["null"], `"code":-32700`)
+}
@@ -0,0 +1,118 @@
+package acrouter
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zfs123/go-ac-router/handle"
+)
+
+func tailHandler(action handle.Action, response handle.Response) {
+	for i := 1; i <= 3; i++ {
+		if err := response.Send(map[string]int{"line": i}); err != nil {
+			return
+		}
+	}
+}
+
+func TestApiStream(t *testing.T) {
+	r, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.AddApiRoute("/tail", "GET", "tail api", nil, nil, tailHandler)
+
+	w := performRequest(r, "GET", "/tail", header{"Accept", "text/event-stream"})
+	assert.Equal(t, "text/event-stream", w.Header().Get("Content-Type"))
+	assert.Equal(t, "id: 1\ndata: {\"line\":1}\n\nid: 2\ndata: {\"line\":2}\n\nid: 3\ndata: {\"line\":3}\n\n", w.Body.String())
+	assert.True(t, w.Flushed)
+
+	w = performRequest(r, "GET", "/tail")
+	assert.Equal(t, "application/x-ndjson", w.Header().Get("Content-Type"))
+	assert.Equal(t, "{\"line\":1}\n{\"line\":2}\n{\"line\":3}\n", w.Body.String())
+}
+
+func TestApiStreamClientGone(t *testing.T) {
+	r, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sendErr error
+	r.AddApiRoute("/tail", "GET", "tail api", nil, nil, func(action handle.Action, response handle.Response) {
+		sendErr = response.Send("line")
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	req := httptest.NewRequest("GET", "/tail", nil).WithContext(ctx)
+	r.api.Engine.ServeHTTP(httptest.NewRecorder(), req)
+	assert.Equal(t, context.Canceled, sendErr)
+}
+
+func TestCliStream(t *testing.T) {
+	os.Args = []string{"-", "tail"}
+	r, _ := New()
+	out := &bytes.Buffer{}
+	r.cli.App.Writer = out
+	r.AddCliCommandByStruct("tail", "tail command", nil, tailHandler)
+	r.Run()
+
+	assert.Equal(t, "{\"line\":1}\n{\"line\":2}\n{\"line\":3}\n", out.String())
+}
+
+func TestCliStreamFormat(t *testing.T) {
+	// the envelope does not wrap stream items and strings are printed as is
+	os.Args = []string{"-", "tail"}
+	r, _ := New(ResponseEnvelope(nil))
+	out := &bytes.Buffer{}
+	r.cli.App.Writer = out
+	r.AddCliCommandByStruct("tail", "tail command", nil, func(action handle.Action, response handle.Response) {
+		_ = response.Send("started")
+		tailHandler(action, response)
+	})
+	r.Run()
+
+	assert.Equal(t, "started\n{\"line\":1}\n{\"line\":2}\n{\"line\":3}\n", out.String())
+}
+
+func TestApiStreamTimeout(t *testing.T) {
+	r, err := New(HandlerTimeout(50 * time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	proceed := make(chan struct{})
+	r.AddApiRoute("/tail", "GET", "tail api", nil, nil, func(action handle.Action, response handle.Response) {
+		_ = response.Send(map[string]int{"line": 1})
+		<-proceed
+		// the stream outlives the handler timeout
+		time.Sleep(100 * time.Millisecond)
+		if action.Context().Err() != nil {
+			return
+		}
+		_ = response.Send(map[string]int{"line": 2})
+	})
+	server := httptest.NewServer(r.api.Engine)
+	defer server.Close()
+
+	client := &http.Client{Timeout: 2 * time.Second}
+	resp, err := client.Get(server.URL + "/tail")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	reader := bufio.NewReader(resp.Body)
+	line, _ := reader.ReadString('\n')
+	close(proceed)
+	assert.Equal(t, "{\"line\":1}\n", line)
+	rest, _ := ioutil.ReadAll(reader)
+	assert.Equal(t, "{\"line\":2}\n", string(rest))
+}
@@ -0,0 +1,61 @@
+package trace
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+)
+
+// Exporter receives every finished span
+type Exporter interface {
+	ExportSpan(span *Span) error
+}
+
+// JSONExporter writes one json object per span and line
+type JSONExporter struct {
+	mu     sync.Mutex
+	w      io.Writer
+	closer io.Closer
+}
+
+// Create an exporter writing to w
+func NewJSONExporter(w io.Writer) *JSONExporter {
+	return &JSONExporter{w: w}
+}
+
+// Create an exporter writing to stdout
+func NewStdoutExporter() *JSONExporter {
+	return NewJSONExporter(os.Stdout)
+}
+
+// Create an exporter appending to the file at path
+func NewFileExporter(path string) (*JSONExporter, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &JSONExporter{w: f, closer: f}, nil
+}
+
+// Write span as a json line
+func (e *JSONExporter) ExportSpan(span *Span) error {
+	span.mu.Lock()
+	b, err := json.Marshal(span)
+	span.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	_, err = e.w.Write(append(b, '\n'))
+	return err
+}
+
+// Close the underlying file, if any
+func (e *JSONExporter) Close() error {
+	if e.closer == nil {
+		return nil
+	}
+	return e.closer.Close()
+}
@@ -0,0 +1,239 @@
+package trace
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// TraceparentHeader is the W3C trace context header
+	TraceparentHeader = "traceparent"
+	// TracestateHeader carries vendor specific trace information
+	TracestateHeader = "tracestate"
+	// FlagSampled is set when the caller recorded the trace
+	FlagSampled byte = 0x01
+)
+
+// TraceID identifies a whole trace
+type TraceID [16]byte
+
+// SpanID identifies a single span
+type SpanID [8]byte
+
+// Hex encoding of the trace id
+func (id TraceID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+// Check whether the trace id is all zeros
+func (id TraceID) IsValid() bool {
+	return id != TraceID{}
+}
+
+// Hex encoding of the span id
+func (id SpanID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+// Check whether the span id is all zeros
+func (id SpanID) IsValid() bool {
+	return id != SpanID{}
+}
+
+// SpanContext is the part of a span propagated across process boundaries
+type SpanContext struct {
+	TraceID    TraceID
+	SpanID     SpanID
+	Flags      byte
+	TraceState string
+}
+
+// Check whether both trace id and span id are set
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID.IsValid() && sc.SpanID.IsValid()
+}
+
+// Format as a version 00 traceparent header
+func (sc SpanContext) Traceparent() string {
+	return "00-" + sc.TraceID.String() + "-" + sc.SpanID.String() + "-" + hex.EncodeToString([]byte{sc.Flags})
+}
+
+// Parse a traceparent header and an optional tracestate header
+func Parse(traceparent, tracestate string) (SpanContext, error) {
+	var sc SpanContext
+	parts := strings.Split(strings.TrimSpace(traceparent), "-")
+	if len(parts) < 4 {
+		return sc, errors.Errorf("invalid traceparent %q", traceparent)
+	}
+	version, err := hex.DecodeString(parts[0])
+	if err != nil || len(version) != 1 || version[0] == 0xff {
+		return sc, errors.Errorf("invalid traceparent version %q", parts[0])
+	}
+	// version 00 has exactly four fields, later versions may append more
+	if version[0] == 0 && len(parts) != 4 {
+		return sc, errors.Errorf("invalid traceparent %q", traceparent)
+	}
+	if err := decodeHex(sc.TraceID[:], parts[1]); err != nil || !sc.TraceID.IsValid() {
+		return sc, errors.Errorf("invalid trace id %q", parts[1])
+	}
+	if err := decodeHex(sc.SpanID[:], parts[2]); err != nil || !sc.SpanID.IsValid() {
+		return sc, errors.Errorf("invalid parent id %q", parts[2])
+	}
+	var flags [1]byte
+	if err := decodeHex(flags[:], parts[3]); err != nil {
+		return sc, errors.Errorf("invalid trace flags %q", parts[3])
+	}
+	sc.Flags = flags[0]
+	sc.TraceState = strings.TrimSpace(tracestate)
+	return sc, nil
+}
+
+// Decode s into dst, s must be lowercase and of the exact length
+func decodeHex(dst []byte, s string) error {
+	if len(s) != hex.EncodedLen(len(dst)) || strings.ToLower(s) != s {
+		return errors.New("invalid length")
+	}
+	_, err := hex.Decode(dst, []byte(s))
+	return err
+}
+
+// Span records a single operation of a trace
+type Span struct {
+	Name         string                 `json:"name"`
+	Kind         string                 `json:"kind"`
+	TraceID      string                 `json:"trace_id"`
+	SpanID       string                 `json:"span_id"`
+	ParentSpanID string                 `json:"parent_span_id,omitempty"`
+	Start        time.Time              `json:"start"`
+	End          time.Time              `json:"end"`
+	Status       string                 `json:"status"`
+	Attributes   map[string]interface{} `json:"attributes,omitempty"`
+
+	mu       sync.Mutex
+	context  SpanContext
+	tracer   *Tracer
+	finished bool
+}
+
+// Propagated context of the span
+func (s *Span) SpanContext() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	return s.context
+}
+
+// Set an attribute, it is ignored after the span ended
+func (s *Span) SetAttribute(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.finished {
+		return
+	}
+	if s.Attributes == nil {
+		s.Attributes = map[string]interface{}{}
+	}
+	s.Attributes[key] = value
+}
+
+// Mark the span as failed
+func (s *Span) SetError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.SetAttribute("error", err.Error())
+	s.SetStatus("error")
+}
+
+// Set the status of the span, it is ignored after the span ended
+func (s *Span) SetStatus(status string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.finished {
+		s.Status = status
+	}
+}
+
+// Finish the span and hand it to the exporter
+func (s *Span) Finish() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.finished {
+		s.mu.Unlock()
+		return
+	}
+	s.finished = true
+	s.End = time.Now()
+	s.mu.Unlock()
+	if s.tracer != nil && s.tracer.exporter != nil {
+		_ = s.tracer.exporter.ExportSpan(s)
+	}
+}
+
+// Tracer creates spans and exports finished ones
+type Tracer struct {
+	exporter Exporter
+}
+
+// Create a tracer exporting to exporter
+func NewTracer(exporter Exporter) *Tracer {
+	return &Tracer{exporter: exporter}
+}
+
+// Start a span, a new trace is started if parent is invalid
+func (t *Tracer) Start(name, kind string, parent SpanContext) *Span {
+	sc := SpanContext{Flags: FlagSampled}
+	if parent.IsValid() {
+		sc.TraceID = parent.TraceID
+		sc.Flags = parent.Flags
+		sc.TraceState = parent.TraceState
+	} else {
+		_, _ = rand.Read(sc.TraceID[:])
+	}
+	_, _ = rand.Read(sc.SpanID[:])
+
+	span := &Span{
+		Name:    name,
+		Kind:    kind,
+		TraceID: sc.TraceID.String(),
+		SpanID:  sc.SpanID.String(),
+		Start:   time.Now(),
+		Status:  "ok",
+		context: sc,
+		tracer:  t,
+	}
+	if parent.IsValid() {
+		span.ParentSpanID = parent.SpanID.String()
+	}
+	return span
+}
+
+type spanKey struct{}
+
+// Return a copy of ctx carrying span
+func ContextWithSpan(ctx context.Context, span *Span) context.Context {
+	return context.WithValue(ctx, spanKey{}, span)
+}
+
+// Get the span stored in ctx, nil if there is none
+func SpanFromContext(ctx context.Context) *Span {
+	if ctx == nil {
+		return nil
+	}
+	span, _ := ctx.Value(spanKey{}).(*Span)
+	return span
+}
@@ -0,0 +1,62 @@
+package acrouter
+
+import (
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/urfave/cli/v2"
+	"github.com/zfs123/go-ac-router/handle"
+	"github.com/zfs123/go-ac-router/trace"
+)
+
+// Environment variables used to continue a trace in cli mode
+const (
+	traceparentEnv = "TRACEPARENT"
+	tracestateEnv  = "TRACESTATE"
+)
+
+// Start a span per request, continuing the trace of the traceparent header
+func tracingMiddleware(tracer *trace.Tracer) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		parent, _ := trace.Parse(c.GetHeader(trace.TraceparentHeader), c.GetHeader(trace.TracestateHeader))
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		span := tracer.Start(c.Request.Method+" "+route, "server", parent)
+		defer span.Finish()
+		span.SetAttribute("http.method", c.Request.Method)
+		span.SetAttribute("http.route", route)
+		span.SetAttribute("http.target", c.Request.URL.RequestURI())
+		span.SetAttribute("http.client_ip", c.ClientIP())
+		span.SetAttribute("request_id", handle.RequestIDFromContext(c.Request.Context()))
+
+		sc := span.SpanContext()
+		c.Header(trace.TraceparentHeader, sc.Traceparent())
+		if sc.TraceState != "" {
+			c.Header(trace.TracestateHeader, sc.TraceState)
+		}
+		c.Request = c.Request.WithContext(trace.ContextWithSpan(c.Request.Context(), span))
+
+		c.Next()
+
+		span.SetAttribute("http.status_code", c.Writer.Status())
+		if c.Writer.Status() >= 500 {
+			span.SetStatus("error")
+		}
+		if len(c.Errors) > 0 {
+			span.SetError(c.Errors.Last())
+		}
+	}
+}
+
+// Start a span for a cli command, continuing the trace of the TRACEPARENT variable
+func startCliSpan(tracer *trace.Tracer, c *cli.Context, command string) *trace.Span {
+	parent, _ := trace.Parse(os.Getenv(traceparentEnv), os.Getenv(tracestateEnv))
+	span := tracer.Start(command, "cli", parent)
+	span.SetAttribute("cli.command", command)
+	span.SetAttribute("cli.args", strings.Join(c.Args().Slice(), " "))
+	c.Context = trace.ContextWithSpan(c.Context, span)
+	return span
+}
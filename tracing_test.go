@@ -0,0 +1,72 @@
+package acrouter
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zfs123/go-ac-router/handle"
+	"github.com/zfs123/go-ac-router/logger"
+	"github.com/zfs123/go-ac-router/trace"
+)
+
+func TestTracing(t *testing.T) {
+	buf := &bytes.Buffer{}
+	r, err := New(Tracing(trace.NewJSONExporter(buf)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sc trace.SpanContext
+	r.AddApiRoute("/hello", "GET", "hello api", nil, nil, func(action handle.Action, response handle.Response) {
+		sc = action.SpanContext()
+		response.Response(http.StatusOK, "hello")
+	})
+
+	parent := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	w := performRequest(r, "GET", "/hello",
+		header{trace.TraceparentHeader, parent}, header{trace.TracestateHeader, "congo=t61rcWkgMzE"})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", sc.TraceID.String())
+	assert.Equal(t, sc.Traceparent(), w.Header().Get(trace.TraceparentHeader))
+	assert.Equal(t, "congo=t61rcWkgMzE", w.Header().Get(trace.TracestateHeader))
+
+	var span trace.Span
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &span))
+	assert.Equal(t, "GET /hello", span.Name)
+	assert.Equal(t, "00f067aa0ba902b7", span.ParentSpanID)
+	assert.Equal(t, sc.SpanID.String(), span.SpanID)
+	assert.Equal(t, float64(http.StatusOK), span.Attributes["http.status_code"])
+}
+
+func TestWithTraceCaller(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "logs")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "test.log")
+	assert.NoError(t, logger.InitLogger(path, 1, 1, 1, false, "info"))
+
+	sc, _ := trace.Parse("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", "")
+	logger.WithTrace(sc).Info("traced")
+	_ = logger.Sync()
+
+	b, _ := ioutil.ReadFile(path)
+	var entry map[string]interface{}
+	assert.NoError(t, json.Unmarshal([]byte(strings.TrimSpace(string(b))), &entry))
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", entry["trace_id"])
+	assert.Contains(t, entry["caller"], "tracing_test.go")
+}
+
+func TestParseTraceparent(t *testing.T) {
+	_, err := trace.Parse("00-00000000000000000000000000000000-00f067aa0ba902b7-01", "")
+	assert.Error(t, err)
+	_, err = trace.Parse("00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01", "")
+	assert.Error(t, err)
+	sc, err := trace.Parse("01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00-future", "")
+	assert.NoError(t, err)
+	assert.Equal(t, byte(0), sc.Flags)
+}
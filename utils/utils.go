@@ -1,8 +1,14 @@
 package utils
 
 import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"os"
 	"reflect"
 	"strings"
+	"time"
 
 	"github.com/pkg/errors"
 )
@@ -66,3 +72,74 @@ func RangeStruct(s interface{}, f func(reflect.Value, reflect.StructField) bool)
 	}
 	return nil
 }
+
+// Generate a random hex string of n bytes
+func RandomHex(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Check whether w is a terminal
+func IsTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+// Get the values allowed by a oneof binding
+func GetEnum(field reflect.StructField) []string {
+	for _, rule := range strings.Split(field.Tag.Get("binding"), ",") {
+		rule = strings.TrimSpace(rule)
+		if strings.HasPrefix(rule, "oneof=") {
+			return strings.Fields(strings.TrimPrefix(rule, "oneof="))
+		}
+	}
+	return nil
+}
+
+// Check whether the field holds a file path
+func IsFile(field reflect.StructField) bool {
+	return field.Tag.Get("file") == "true"
+}
+
+// Find the field bound from the parameter name
+func FindField(s interface{}, name string) (field reflect.StructField, ok bool) {
+	_ = RangeStruct(s, func(value reflect.Value, f reflect.StructField) bool {
+		if GetForm(f) == name {
+			field, ok = f, true
+			return false
+		}
+		return true
+	})
+	return
+}
+
+// detached keeps the values of a context but drops its deadline and cancellation
+type detached struct {
+	context.Context
+}
+
+func (detached) Deadline() (time.Time, bool) {
+	return time.Time{}, false
+}
+
+func (detached) Done() <-chan struct{} {
+	return nil
+}
+
+func (detached) Err() error {
+	return nil
+}
+
+// Detach ctx from its cancellation, so work like jobs or a shell session
+// outlives the request or command that started it
+func Detach(ctx context.Context) context.Context {
+	return detached{ctx}
+}
@@ -0,0 +1,199 @@
+package acrouter
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/urfave/cli/v2"
+	"github.com/zfs123/go-ac-router/handle"
+	"github.com/zfs123/go-ac-router/utils"
+)
+
+// WebSocketConfig configures websocket routes
+type WebSocketConfig struct {
+	// Interval of keepalive pings
+	PingInterval time.Duration
+	// Time the peer gets to answer a ping, must be longer than PingInterval
+	PongWait time.Duration
+	// Time allowed to write a message
+	WriteWait time.Duration
+	// Largest message accepted, larger ones close the connection
+	MaxMessageSize int64
+	// Check the origin of upgrade requests, same origin only if nil
+	CheckOrigin func(r *http.Request) bool
+}
+
+func defaultWebSocketConfig() WebSocketConfig {
+	return WebSocketConfig{
+		PingInterval:   30 * time.Second,
+		PongWait:       60 * time.Second,
+		WriteWait:      10 * time.Second,
+		MaxMessageSize: 1 << 20,
+	}
+}
+
+// Add a route upgrading to websocket and a cli command connecting to it
+//
+// params are bound from the query of the upgrade request, messages are
+// exchanged as json through the conn passed to handleFunc
+func (r *Router) AddWebSocketRoute(path string, description string, params interface{}, handleFunc handle.WebSocketFunc, opts ...RouteOption) {
+	route := newRoute(path, http.MethodGet, description, params, nil, nil, opts)
+	route.WebSocketFunc = handleFunc
+	r.routes = append(r.routes, route)
+	autoAddApiRoute(r.api.Engine, path, http.MethodGet, r.apiHandlers(route)...)
+	r.cli.AddCommand(r.webSocketCommand(path[1:], route))
+}
+
+// Upgrade the request and run the handler with keepalive pings
+func (r *Router) webSocketHandler(route *Route) gin.HandlerFunc {
+	config := r.config.WebSocket
+	upgrader := websocket.Upgrader{CheckOrigin: config.CheckOrigin}
+	return func(c *gin.Context) {
+		ws, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+		if err != nil {
+			// the upgrader already answered with an error status
+			return
+		}
+		ws.SetReadLimit(config.MaxMessageSize)
+		_ = ws.SetReadDeadline(time.Now().Add(config.PongWait))
+		ws.SetPongHandler(func(string) error {
+			return ws.SetReadDeadline(time.Now().Add(config.PongWait))
+		})
+
+		conn := handle.NewWebSocketConn(c.Request.Context(), ws, config.WriteWait)
+		defer conn.Close()
+		go func() {
+			ticker := time.NewTicker(config.PingInterval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-conn.Context().Done():
+					return
+				case <-ticker.C:
+					if err := conn.Ping(); err != nil {
+						return
+					}
+				}
+			}
+		}()
+		route.WebSocketFunc(handle.NewApiAction(c), conn)
+	}
+}
+
+// Build the cli command connecting to a websocket route of a remote server,
+// stdin lines are sent as messages and received messages are printed
+func (r *Router) webSocketCommand(path string, route *Route) *cli.Command {
+	flags := buildCliFlag(route.Params)
+	flags = append(flags, &cli.StringFlag{
+		Name:  "remote",
+		Usage: "base url of the server",
+		Value: "ws://" + r.config.Addr + ":" + strconv.Itoa(r.config.Port),
+	})
+	name := strings.Replace(path, "/", "_", -1)
+	r.commandRoutes[name] = route
+	return &cli.Command{
+		Name:        name,
+		Aliases:     []string{path},
+		Usage:       route.Description,
+		Description: route.Requirements(),
+		Flags:       flags,
+		Action: func(c *cli.Context) error {
+			target := strings.TrimRight(c.String("remote"), "/") + route.Path
+			if query := cliQuery(c, route.Params).Encode(); query != "" {
+				target += "?" + query
+			}
+			return r.pipeWebSocket(c, target)
+		},
+	}
+}
+
+// Encode the flags set on the command line as query parameters
+func cliQuery(c *cli.Context, params interface{}) url.Values {
+	query := url.Values{}
+	_ = utils.RangeStruct(params, func(value reflect.Value, field reflect.StructField) bool {
+		alia := utils.GetForm(field)
+		if alia == "" || !c.IsSet(alia) {
+			return true
+		}
+		if _, ok := value.Interface().([]string); ok {
+			query[alia] = c.StringSlice(alia)
+		} else {
+			query.Set(alia, c.String(alia))
+		}
+		return true
+	})
+	return query
+}
+
+func (r *Router) pipeWebSocket(c *cli.Context, target string) error {
+	config := r.config.WebSocket
+	ws, _, err := websocket.DefaultDialer.DialContext(c.Context, target, nil)
+	if err != nil {
+		return cli.Exit(fmt.Sprintf("connect %s: %s", target, err), 1)
+	}
+	defer ws.Close()
+	ws.SetReadLimit(config.MaxMessageSize)
+
+	received := make(chan error, 1)
+	go func() {
+		for {
+			_, data, err := ws.ReadMessage()
+			if err != nil {
+				received <- err
+				return
+			}
+			_, _ = fmt.Fprintln(c.App.Writer, strings.TrimRight(string(data), "\n"))
+		}
+	}()
+
+	lines := make(chan string)
+	go func() {
+		defer close(lines)
+		scanner := bufio.NewScanner(c.App.Reader)
+		scanner.Buffer(make([]byte, 64*1024), int(config.MaxMessageSize))
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+	}()
+
+	for {
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				// stdin is done, close and wait for the server to finish
+				_ = ws.WriteControl(websocket.CloseMessage,
+					websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(config.WriteWait))
+				lines = nil
+				continue
+			}
+			if err := ws.WriteMessage(websocket.TextMessage, jsonMessage(line)); err != nil {
+				return err
+			}
+		case err := <-received:
+			if websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				return nil
+			}
+			return cli.Exit(err.Error(), 1)
+		case <-c.Context.Done():
+			return nil
+		}
+	}
+}
+
+// Lines holding json are sent as is, other lines as json strings
+func jsonMessage(line string) []byte {
+	if json.Valid([]byte(line)) {
+		return []byte(line)
+	}
+	b, _ := json.Marshal(line)
+	return b
+}
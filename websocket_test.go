@@ -0,0 +1,143 @@
+package acrouter
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/zfs123/go-ac-router/handle"
+)
+
+type chatParams struct {
+	Room string `form:"room" binding:"required"`
+}
+
+type chatMessage struct {
+	Text string `json:"text" binding:"required"`
+}
+
+func newChatRouter(t *testing.T) *Router {
+	r, err := New(WebSocket(WebSocketConfig{MaxMessageSize: 64}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.AddWebSocketRoute("/chat", "chat room", &chatParams{}, func(action handle.Action, conn handle.Conn) {
+		var params chatParams
+		if err := action.ShouldBind(&params); err != nil {
+			_ = conn.Send(map[string]string{"error": err.Error()})
+			return
+		}
+		for {
+			var msg chatMessage
+			if err := conn.Receive(&msg); err != nil {
+				if _, ok := err.(*websocket.CloseError); ok || conn.Context().Err() != nil {
+					return
+				}
+				_ = conn.Send(map[string]string{"error": "invalid message"})
+				continue
+			}
+			_ = conn.Send(map[string]string{"room": params.Room, "echo": msg.Text})
+		}
+	})
+	return r
+}
+
+func TestWebSocketRoute(t *testing.T) {
+	r := newChatRouter(t)
+	server := httptest.NewServer(r.api.Engine)
+	defer server.Close()
+
+	ws, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/chat?room=go", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+
+	assert.NoError(t, ws.WriteJSON(map[string]string{"text": "hi"}))
+	var reply map[string]string
+	assert.NoError(t, ws.ReadJSON(&reply))
+	assert.Equal(t, map[string]string{"room": "go", "echo": "hi"}, reply)
+
+	assert.NoError(t, ws.WriteJSON(map[string]string{}))
+	assert.NoError(t, ws.ReadJSON(&reply))
+	assert.Equal(t, "invalid message", reply["error"])
+
+	assert.NoError(t, ws.WriteJSON(map[string]string{"text": strings.Repeat("x", 100)}))
+	_, _, err = ws.ReadMessage()
+	assert.True(t, websocket.IsCloseError(err, websocket.CloseMessageTooBig))
+}
+
+func TestWebSocketCliCommand(t *testing.T) {
+	server := httptest.NewServer(newChatRouter(t).api.Engine)
+	defer server.Close()
+
+	os.Args = []string{"-", "chat", "--room", "cli", "--remote", "ws" + strings.TrimPrefix(server.URL, "http")}
+	r := newChatRouter(t)
+	out := &bytes.Buffer{}
+	r.cli.App.Writer = out
+	r.cli.App.Reader = strings.NewReader("{\"text\":\"one\"}\n{\"text\":\"two\"}\n")
+	r.Run()
+
+	assert.Equal(t, "{\"echo\":\"one\",\"room\":\"cli\"}\n{\"echo\":\"two\",\"room\":\"cli\"}\n", out.String())
+}
+
+func TestWebSocketKeepaliveWithoutReceive(t *testing.T) {
+	r, err := New(WebSocket(WebSocketConfig{PingInterval: 10 * time.Millisecond, PongWait: 50 * time.Millisecond}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan struct{})
+	r.AddWebSocketRoute("/events", "event feed", nil, func(action handle.Action, conn handle.Conn) {
+		defer close(done)
+		// the handler only sends, the router still notices the peer is gone
+		<-conn.Context().Done()
+	})
+	server := httptest.NewServer(r.api.Engine)
+	defer server.Close()
+
+	ws, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/events", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+
+	// the client never reads, so pings are not answered
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("read deadline was not enforced")
+	}
+}
+
+func TestWebSocketReceiveQueueFull(t *testing.T) {
+	r, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.AddWebSocketRoute("/events", "event feed", nil, func(action handle.Action, conn handle.Conn) {
+		<-conn.Context().Done()
+	})
+	server := httptest.NewServer(r.api.Engine)
+	defer server.Close()
+
+	ws, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/events", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+
+	// messages the handler does not read are not dropped silently
+	for i := 0; i < 100; i++ {
+		if err := ws.WriteJSON(map[string]int{"n": i}); err != nil {
+			break
+		}
+	}
+	_ = ws.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, _, err = ws.ReadMessage()
+	assert.True(t, websocket.IsCloseError(err, websocket.ClosePolicyViolation), "%v", err)
+}